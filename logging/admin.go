@@ -0,0 +1,235 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AdminHandler is an http.Handler to inspect and change the loggers returned
+// by Loggers at runtime, e.g. mounted on a debug port:
+//
+//	http.Handle("/debug/logging", logging.NewAdminHandler())
+//
+// A GET request returns the loggers in JSON. A POST or PUT request takes an
+// AdminRequest in JSON, applies it to the loggers with the name, and returns
+// them in JSON.
+type AdminHandler struct {
+	lock   sync.Mutex
+	timers map[*core]*expiry // timers restoring expired levels
+}
+
+// expiry restores the level of a logger when the timer fires.
+type expiry struct {
+	timer    *time.Timer
+	previous Level
+	restored chan bool // closed when the level is restored
+}
+
+// adminConflict is the error of a request which cannot be applied to the
+// state of a logger, e.g. a format for a logger without a handler.
+type adminConflict string
+
+func (e adminConflict) Error() string {
+	return string(e)
+}
+
+// AdminRequest is the body of a POST or PUT request to an AdminHandler. The
+// fields which are not set are left unchanged.
+type AdminRequest struct {
+	Name   string `json:"name"`   // name of the loggers to change
+	Level  string `json:"level"`  // new level of the loggers
+	Expire string `json:"expire"` // duration after which the level is restored, e.g. "10m"
+	Format string `json:"format"` // new record format of the loggers
+	Flush  bool   `json:"flush"`  // flush the loggers
+}
+
+// AdminLogger describes a logger in the response of an AdminHandler.
+type AdminLogger struct {
+	Name           string         `json:"name"`
+	Level          Level          `json:"level"`
+	EffectiveLevel Level          `json:"effectiveLevel"`
+	Propagate      bool           `json:"propagate"`
+	ModuleLevels   string         `json:"moduleLevels,omitempty"`
+	Handlers       []AdminHandled `json:"handlers"`
+}
+
+// AdminHandled describes a handler of a logger in the response of an
+// AdminHandler. Only the type is set for handlers other than WriterHandler.
+type AdminHandled struct {
+	Type       string `json:"type"`
+	Level      Level  `json:"level"`
+	Format     string `json:"format,omitempty"`
+	Writer     string `json:"writer,omitempty"`
+	Sync       bool   `json:"sync"`
+	QueueDepth int    `json:"queueDepth"`
+	QueueSize  int    `json:"queueSize"`
+	Dropped    uint64 `json:"dropped"`
+}
+
+// NewAdminHandler creates a new AdminHandler.
+func NewAdminHandler() *AdminHandler {
+	return &AdminHandler{timers: make(map[*core]*expiry)}
+}
+
+// ServeHTTP serves the requests to list and change the loggers.
+func (admin *AdminHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET", "HEAD":
+		admin.reply(w, Loggers())
+	case "POST", "PUT":
+		var ar AdminRequest
+		if err := json.NewDecoder(req.Body).Decode(&ar); err != nil {
+			http.Error(w, "logging admin error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		loggers, err := admin.apply(&ar)
+		if _, ok := err.(adminConflict); ok {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(loggers) == 0 {
+			http.Error(w, "logging admin error: no logger "+ar.Name, http.StatusNotFound)
+			return
+		}
+		admin.reply(w, loggers)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, PUT")
+		http.Error(w, "logging admin error: method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// apply checks the request and applies it to the loggers with the name. No
+// logger is changed if the request is illegal, or if it is a conflict with
+// the state of a logger.
+func (admin *AdminHandler) apply(ar *AdminRequest) ([]*Logger, error) {
+	var loggers []*Logger
+	for _, logger := range Loggers() {
+		if logger.Name() == ar.Name {
+			loggers = append(loggers, logger)
+		}
+	}
+	var level Level
+	var expire time.Duration
+	var err error
+	if ar.Level != "" {
+		if level, err = ParseLevel(ar.Level); err != nil {
+			return nil, err
+		}
+	}
+	if ar.Expire != "" {
+		if ar.Level == "" {
+			return nil, fmt.Errorf("logging admin error: expire without level")
+		}
+		if expire, err = time.ParseDuration(ar.Expire); err != nil || expire <= 0 {
+			return nil, fmt.Errorf("logging admin error: bad expire %s", ar.Expire)
+		}
+	}
+	if ar.Format != "" {
+		if _, err = parseFormat(ar.Format); err != nil {
+			return nil, err
+		}
+		for _, logger := range loggers {
+			if logger.Handler() == nil {
+				return nil, adminConflict("logging admin error: no handler to format " + logger.Name())
+			}
+			if logger.Handler().Encoder() != nil {
+				return nil, adminConflict("logging admin error: encoder set for " + logger.Name())
+			}
+		}
+	}
+	for _, logger := range loggers {
+		if ar.Format != "" {
+			if err = logger.SetFormat(ar.Format); err != nil {
+				return nil, err
+			}
+		}
+		if ar.Level != "" {
+			admin.setLevel(logger, level, expire)
+		}
+		if ar.Flush {
+			logger.Flush()
+		}
+	}
+	return loggers, nil
+}
+
+// setLevel sets the level of logger, and restores it after expire if expire
+// is positive. A level set before an earlier one expires cancels the
+// restoring of the earlier one, and restores the level before it instead.
+func (admin *AdminHandler) setLevel(logger *Logger, level Level, expire time.Duration) {
+	admin.lock.Lock()
+	defer admin.lock.Unlock()
+	previous := logger.Level()
+	if e, ok := admin.timers[logger.core]; ok {
+		e.timer.Stop()
+		delete(admin.timers, logger.core)
+		previous = e.previous
+	}
+	logger.SetLevel(level)
+	if expire <= 0 {
+		return
+	}
+	e := &expiry{previous: previous, restored: make(chan bool)}
+	e.timer = time.AfterFunc(expire, func() {
+		admin.lock.Lock()
+		defer admin.lock.Unlock()
+		if admin.timers[logger.core] == e {
+			delete(admin.timers, logger.core)
+			logger.SetLevel(e.previous)
+			close(e.restored)
+		}
+	})
+	admin.timers[logger.core] = e
+}
+
+// reply writes the loggers in JSON.
+func (admin *AdminHandler) reply(w http.ResponseWriter, loggers []*Logger) {
+	list := make([]AdminLogger, len(loggers))
+	for i, logger := range loggers {
+		al := &list[i]
+		al.Name = logger.Name()
+		al.Level = logger.Level()
+		al.EffectiveLevel = logger.EffectiveLevel()
+		al.Propagate = logger.Propagate()
+		al.ModuleLevels = logger.ModuleLevels()
+		al.Handlers = make([]AdminHandled, 0, len(logger.Handlers()))
+		for _, handler := range logger.Handlers() {
+			ah := AdminHandled{Type: fmt.Sprintf("%T", handler)}
+			if h, ok := handler.(*WriterHandler); ok {
+				ah.Level = h.Level()
+				ah.Format = h.Format()
+				ah.Writer = fmt.Sprintf("%T", h.Writer())
+				ah.Sync = h.Sync()
+				ah.QueueDepth = h.QueueDepth()
+				ah.QueueSize = h.QueueSize()
+				ah.Dropped = h.Dropped()
+			}
+			al.Handlers = append(al.Handlers, ah)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,113 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminHandler(t *testing.T) {
+	var b bytes.Buffer
+	logger, _ := WriterLogger("admin", WARNING, "{levelname} {message}", DefaultTimeFormat, &b, false)
+	defer logger.Destroy()
+	admin := NewAdminHandler()
+	server := httptest.NewServer(admin)
+	defer server.Close()
+
+	post := func(body string) (int, []AdminLogger) {
+		resp, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		defer resp.Body.Close()
+		var list []AdminLogger
+		json.NewDecoder(resp.Body).Decode(&list)
+		return resp.StatusCode, list
+	}
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	var list []AdminLogger
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	found := false
+	for _, al := range list {
+		if al.Name == "admin" {
+			found = true
+			h := al.Handlers[0]
+			if al.Level != WARNING || h.Writer != "*bytes.Buffer" || h.Sync || h.QueueSize != DefaultRequestSize {
+				t.Errorf("%+v\n", al)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("%v\n", list)
+	}
+
+	code, list := post(`{"name":"admin","level":"debug","expire":"50ms","format":"{levelname}: {message}","flush":true}`)
+	if code != http.StatusOK || len(list) != 1 || list[0].Level != DEBUG || list[0].Handlers[0].Format != "{levelname}: {message}" {
+		t.Errorf("%v, %+v\n", code, list)
+	}
+	logger.Debug("debug")
+	logger.Flush()
+	if b.String() != "DEBUG: debug\n" {
+		t.Errorf("%q\n", b.String())
+	}
+	admin.lock.Lock()
+	e := admin.timers[logger.core]
+	admin.lock.Unlock()
+	select {
+	case <-e.restored:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%v\n", "level not restored")
+	}
+	if logger.Level() != WARNING {
+		t.Errorf("%v\n", logger.Level())
+	}
+
+	if code, _ := post(`{"name":"admin","format":"{unknown}"}`); code != http.StatusBadRequest {
+		t.Errorf("%v\n", code)
+	}
+	child := GetLogger("adminchild")
+	if code, _ := post(`{"name":"adminchild","format":"{message}"}`); code != http.StatusConflict {
+		t.Errorf("%v\n", code)
+	}
+	encoder, _ := NewJSONEncoder("message")
+	logger.SetEncoder(encoder)
+	if code, _ := post(`{"name":"admin","level":"info","format":"{message}"}`); code != http.StatusConflict || logger.Level() != WARNING {
+		t.Errorf("%v, %v\n", code, logger.Level())
+	}
+	logger.SetEncoder(nil)
+	// GetLogger creates the root as the parent of the child
+	child.Destroy()
+	GetLogger("").Destroy()
+	if code, _ := post(`{"name":"nonexistent","flush":true}`); code != http.StatusNotFound {
+		t.Errorf("%v\n", code)
+	}
+	req, _ := http.NewRequest("DELETE", server.URL, nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.Body.Close() != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("%v, %v\n", resp, err)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retention configures the compression and pruning of the archives, i.e.,
+// the rotated files, of a RotatingFileWriter or a TimedFileWriter. The
+// archives are compressed and pruned in a goroutine after each rotation, so
+// that writing records is never blocked by them.
+type Retention struct {
+	Compress   string        // compressor, "gzip" or one registered by RegisterCompressor, or "" not to compress
+	MaxBackups int           // maximum number of archives, 0 for no limit
+	MaxBytes   int64         // maximum total size of archives, 0 for no limit
+	MaxAge     time.Duration // maximum age of archives, 0 for no limit
+	Errors     chan<- error  // channel receiving errors, which are dropped if it is full or nil
+}
+
+// compressor compresses archives to files with an extension.
+type compressor struct {
+	ext string
+	fn  func(w io.Writer) (io.WriteCloser, error)
+}
+
+// The compressors, which can be extended by RegisterCompressor
+var compressors = map[string]compressor{
+	"gzip": {".gz", func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }},
+}
+
+// compressorsLock protects compressors.
+var compressorsLock sync.RWMutex
+
+// RegisterCompressor registers a compressor for Retention, which writes
+// archives with the extension ext. Only gzip is built in. zstd is not built
+// in, and it must be registered with an encoder from another package, e.g.:
+//
+//	logging.RegisterCompressor("zstd", ".zst", func(w io.Writer) (io.WriteCloser, error) {
+//		return zstd.NewWriter(w)
+//	})
+func RegisterCompressor(name string, ext string, fn func(w io.Writer) (io.WriteCloser, error)) {
+	compressorsLock.Lock()
+	defer compressorsLock.Unlock()
+	compressors[name] = compressor{ext, fn}
+}
+
+// archiver compresses and prunes the archives of a file in a goroutine.
+type archiver struct {
+	f         *appendFile
+	list      func() []string // archives, oldest first, called with the lock of f held
+	retention Retention
+	compress  compressor
+	signal    chan bool // signal to compress and prune
+	done      chan bool // closed to stop the goroutine
+}
+
+// retain starts an archiver for f with the retention, replacing the old one,
+// if any.
+func (f *appendFile) retain(retention Retention, list func() []string) error {
+	var c compressor
+	if retention.Compress != "" {
+		compressorsLock.RLock()
+		var ok bool
+		c, ok = compressors[retention.Compress]
+		compressorsLock.RUnlock()
+		if !ok {
+			return errors.New("logging compressor error: " + retention.Compress + " is not registered")
+		}
+	}
+	a := &archiver{f, list, retention, c, make(chan bool, 1), make(chan bool)}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.archive != nil {
+		close(f.archive.done)
+	}
+	f.archive = a
+	if !f.closed {
+		go a.run()
+		a.signal <- true
+	}
+	return nil
+}
+
+// archived signals the archiver, if any, to handle a new archive, with the
+// lock held. It never blocks.
+func (f *appendFile) archived() {
+	if f.archive == nil {
+		return
+	}
+	select {
+	case f.archive.signal <- true:
+	default:
+	}
+}
+
+// ext returns the extension of compressed archives, with the lock held.
+func (f *appendFile) ext() string {
+	if f.archive == nil {
+		return ""
+	}
+	return f.archive.compress.ext
+}
+
+// run compresses and prunes the archives on signals.
+func (a *archiver) run() {
+	for {
+		select {
+		case <-a.signal:
+			a.compressAll()
+			a.prune()
+		case <-a.done:
+			return
+		}
+	}
+}
+
+// reportError sends err to the error channel errs without blocking, so
+// errors are dropped if errs is full or nil.
+func reportError(errs chan<- error, err error) {
+	select {
+	case errs <- err:
+	default:
+	}
+}
+
+// compressAll compresses the archives which are not compressed yet.
+func (a *archiver) compressAll() {
+	if a.compress.fn == nil {
+		return
+	}
+	a.f.lock.Lock()
+	names := a.list()
+	a.f.lock.Unlock()
+	for _, name := range names {
+		if !strings.HasSuffix(name, a.compress.ext) {
+			if err := a.compressFile(name); err != nil {
+				reportError(a.retention.Errors, err)
+			}
+		}
+	}
+}
+
+// compressFile compresses the archive to a temporary file without the lock,
+// and then replaces the archive if it is not renamed by a rotation in the
+// meantime. Otherwise the next signal, sent by the rotation, retries it.
+func (a *archiver) compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	tmp := name + a.compress.ext + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	w, err := a.compress.fn(dst)
+	if err == nil {
+		_, err = io.Copy(w, src)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	a.f.lock.Lock()
+	defer a.f.lock.Unlock()
+	if current, err := os.Stat(name); err != nil || !os.SameFile(info, current) {
+		return nil
+	}
+	if err := os.Rename(tmp, name+a.compress.ext); err != nil {
+		return err
+	}
+	os.Chtimes(name+a.compress.ext, info.ModTime(), info.ModTime())
+	return os.Remove(name)
+}
+
+// prune removes the oldest archives over the limits of the retention.
+func (a *archiver) prune() {
+	r := a.retention
+	if r.MaxBackups <= 0 && r.MaxBytes <= 0 && r.MaxAge <= 0 {
+		return
+	}
+	a.f.lock.Lock()
+	defer a.f.lock.Unlock()
+	names := a.list()
+	infos := make([]os.FileInfo, len(names))
+	var total int64
+	for i, name := range names {
+		if info, err := os.Stat(name); err == nil {
+			infos[i] = info
+			total += info.Size()
+		}
+	}
+	now := time.Now()
+	for i, name := range names {
+		info := infos[i]
+		if info == nil {
+			continue
+		}
+		if r.MaxBackups > 0 && len(names)-i > r.MaxBackups ||
+			r.MaxBytes > 0 && total > r.MaxBytes ||
+			r.MaxAge > 0 && now.Sub(info.ModTime()) > r.MaxAge {
+			if err := os.Remove(name); err != nil {
+				reportError(a.retention.Errors, err)
+			}
+			total -= info.Size()
+		}
+	}
+}
+
+// SetRetention sets the compression and pruning of the archives of a handler
+// created by NewRotatingFileHandler or NewTimedFileHandler.
+func (handler *WriterHandler) SetRetention(retention Retention) error {
+	if w, ok := handler.fd.(interface {
+		SetRetention(retention Retention) error
+	}); ok {
+		return w.SetRetention(retention)
+	}
+	return errors.New("logging retention error: no rotation")
+}
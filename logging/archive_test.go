@@ -0,0 +1,97 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitFiles waits for the files in dir to be the expected ones.
+func waitFiles(dir string, expected []string) []string {
+	var names []string
+	for i := 0; i < 100; i++ {
+		infos, _ := ioutil.ReadDir(dir)
+		names = names[:0]
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		if fmt.Sprint(names) == fmt.Sprint(expected) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return names
+}
+
+func TestRetention(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logging")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "logging.log")
+	w, _ := NewRotatingFileWriter(file, 7, 3)
+	for _, compress := range []string{"unknown", "zstd"} {
+		if err := w.SetRetention(Retention{Compress: compress}); err == nil {
+			t.Errorf("%s: %v\n", compress, err)
+		}
+	}
+	if err := w.SetRetention(Retention{Compress: "gzip"}); err != nil {
+		t.Errorf("%v\n", err)
+	}
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+	expected := []string{"logging.log", "logging.log.1.gz", "logging.log.2.gz", "logging.log.3.gz"}
+	if names := waitFiles(dir, expected); fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("%v\n", names)
+	}
+	w.Close()
+	fd, _ := os.Open(file + ".3.gz")
+	r, err := gzip.NewReader(fd)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	fd.Close()
+	if string(data) != "line 1\n" {
+		t.Errorf("%q\n", data)
+	}
+
+	dir, _ = ioutil.TempDir("", "logging")
+	defer os.RemoveAll(dir)
+	now := time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)
+	tw, err := newTimedFileWriter(filepath.Join(dir, "app-2006-01-02.log"), Daily, "", true, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "other.log"), []byte("other\n"), 0644)
+	tw.SetRetention(Retention{Compress: "gzip", MaxBackups: 1})
+	for i := 0; i < 3; i++ {
+		tw.Write([]byte("line\n"))
+		now = now.AddDate(0, 0, 1)
+	}
+	tw.Write([]byte("line\n"))
+	expected = []string{"app-2016-01-04.log.gz", "app-2016-01-05.log", "other.log"}
+	if names := waitFiles(dir, expected); fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("%v\n", names)
+	}
+	tw.Close()
+}
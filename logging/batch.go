@@ -0,0 +1,194 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batcher queues records and passes them in batches to a send function in a
+// goroutine, like the watcher of an async WriterHandler, when it has
+// bufferSize records or after timeInterval milliseconds. Its queue handles
+// the overflow by the same policies as the one of an async WriterHandler.
+type batcher struct {
+	queue        *queue    // queue of records
+	flush        chan bool // flush signal for the goroutine to send
+	finish       chan bool // finish flush signal for the flush function to return
+	quit         chan bool // quit signal for the goroutine to quit
+	done         chan bool // closed when closed, to ignore records and flushes
+	close        sync.Once // make Close run only once
+	bufferSize   int
+	timeInterval time.Duration
+	send         func(batch []Record)
+}
+
+// newBatcher creates a batcher and starts its goroutine.
+func newBatcher(bufferSize int, timeInterval time.Duration, send func(batch []Record)) *batcher {
+	b := &batcher{
+		queue:        newQueue(DefaultRequestSize),
+		flush:        make(chan bool),
+		finish:       make(chan bool),
+		quit:         make(chan bool),
+		done:         make(chan bool),
+		bufferSize:   bufferSize,
+		timeInterval: timeInterval,
+		send:         send,
+	}
+	go b.run()
+	return b
+}
+
+// push queues a copy of the record, unless the batcher is closed. A push
+// blocked by a full queue returns when the batcher is closed.
+func (b *batcher) push(r *Record) {
+	select {
+	case <-b.done:
+	default:
+		b.queue.push(r, b.done)
+	}
+}
+
+// run collects records to batches and sends them.
+func (b *batcher) run() {
+	batch := make([]Record, 0, b.bufferSize)
+	for {
+		timeout := time.After(time.Millisecond * b.timeInterval)
+		for wait := true; wait && len(batch) < b.bufferSize; {
+			select {
+			case <-b.queue.ready:
+				if req, ok := b.queue.pop(); ok {
+					batch = append(batch, req)
+				}
+			case <-timeout:
+				wait = false
+			case <-b.flush:
+				batch = b.drain(batch)
+				b.sendBatch(batch)
+				batch = batch[:0]
+				b.finish <- true
+				wait = false
+			case <-b.quit:
+				batch = b.drain(batch)
+				b.sendBatch(batch)
+				b.quit <- true
+				return
+			}
+		}
+		b.sendBatch(batch)
+		batch = batch[:0]
+	}
+}
+
+// drain appends the records queued when it is called to the batch, sending
+// it whenever it is full, so that it returns even if records keep coming.
+func (b *batcher) drain(batch []Record) []Record {
+	for n := b.queue.len(); n > 0; n-- {
+		req, ok := b.queue.pop()
+		if !ok {
+			break
+		}
+		if batch = append(batch, req); len(batch) >= b.bufferSize {
+			b.sendBatch(batch)
+			batch = batch[:0]
+		}
+	}
+	return batch
+}
+
+// sendBatch sends a batch if it is not empty.
+func (b *batcher) sendBatch(batch []Record) {
+	if len(batch) > 0 {
+		b.send(batch)
+	}
+}
+
+// Flush sends the queued records and waits for them to be sent.
+func (b *batcher) Flush() {
+	select {
+	case b.flush <- true:
+		<-b.finish
+	case <-b.done:
+	}
+}
+
+// Close sends the queued records and stops the goroutine. Calls after the
+// first one do nothing.
+func (b *batcher) Close() {
+	b.close.Do(func() {
+		close(b.done)
+		b.quit <- true
+		<-b.quit
+	})
+}
+
+// QueueDepth returns the number of records waiting in the queue.
+func (b *batcher) QueueDepth() int {
+	return b.queue.len()
+}
+
+// Dropped returns the number of records dropped by the overflow policy.
+func (b *batcher) Dropped() uint64 {
+	return atomic.LoadUint64(&b.queue.dropped)
+}
+
+// SetOverflow sets the policy when the queue is full, with the timeout of
+// OverflowBlockTimeout.
+func (b *batcher) SetOverflow(overflow Overflow, timeout time.Duration) {
+	b.queue.lock.Lock()
+	defer b.queue.lock.Unlock()
+	b.queue.overflow = overflow
+	b.queue.timeout = timeout
+}
+
+// SetQueueBytes bounds the queue by the estimated bytes of its records
+// instead of their number, if maxBytes is positive.
+func (b *batcher) SetQueueBytes(maxBytes int64) {
+	atomic.StoreInt64(&b.queue.maxBytes, maxBytes)
+}
+
+// SetDropReport sets whether a WARNING record of the number of dropped
+// records, from the logger named "logging", is sent once the queue has space
+// again.
+func (b *batcher) SetDropReport(report bool) {
+	b.queue.lock.Lock()
+	defer b.queue.lock.Unlock()
+	b.queue.report = report
+}
+
+// retryBackoff calls try until it succeeds, it fails in a way that should
+// not be retried, or it fails after maxRetries retries, waiting between
+// the calls with exponential backoff from 100ms up to 10s. It stops retrying
+// once done is closed. It returns the last error.
+func retryBackoff(maxRetries int, done <-chan bool, try func() (retry bool, err error)) error {
+	backoff := 100 * time.Millisecond
+	for i := 0; ; i++ {
+		retry, err := try()
+		if err == nil || !retry || i >= maxRetries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-done:
+			return err
+		}
+		if backoff *= 2; backoff > 10*time.Second {
+			backoff = 10 * time.Second
+		}
+	}
+}
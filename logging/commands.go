@@ -16,6 +16,11 @@
 
 package logging
 
+import (
+	"context"
+	"fmt"
+)
+
 // Log receives log request from the client. The request includes a set of
 // variables.
 func (logger *Logger) Log(level Level, v ...interface{}) {
@@ -37,8 +42,18 @@ func (logger *Logger) Critical(v ...interface{}) {
 	logger.log(CRITICAL, v...)
 }
 
+// Fatal logs with level FATAL, flushes and closes the handlers of the logger
+// and its ancestors, and calls the exit function with code 1.
 func (logger *Logger) Fatal(v ...interface{}) {
+	logger.log(FATAL, v...)
+	logger.fatal()
+}
+
+// Panic logs with level CRITICAL, flushes the handlers of the logger and its
+// ancestors, and panics with the message.
+func (logger *Logger) Panic(v ...interface{}) {
 	logger.log(CRITICAL, v...)
+	logger.panic(fmt.Sprint(v...))
 }
 
 func (logger *Logger) Error(v ...interface{}) {
@@ -69,8 +84,16 @@ func (logger *Logger) Criticalf(format string, v ...interface{}) {
 	logger.logf(CRITICAL, format, v...)
 }
 
+// Fatalf is like Fatal with a format.
 func (logger *Logger) Fatalf(format string, v ...interface{}) {
+	logger.logf(FATAL, format, v...)
+	logger.fatal()
+}
+
+// Panicf is like Panic with a format.
+func (logger *Logger) Panicf(format string, v ...interface{}) {
 	logger.logf(CRITICAL, format, v...)
+	logger.panic(fmt.Sprintf(format, v...))
 }
 
 func (logger *Logger) Errorf(format string, v ...interface{}) {
@@ -96,3 +119,93 @@ func (logger *Logger) Debugf(format string, v ...interface{}) {
 func (logger *Logger) Notsetf(format string, v ...interface{}) {
 	logger.logf(NOTSET, format, v...)
 }
+
+// LogCtx is like Log, and attaches the key/value pairs extracted from ctx by
+// the functions registered by RegisterContextExtractor.
+func (logger *Logger) LogCtx(ctx context.Context, level Level, v ...interface{}) {
+	logger.logCtx(ctx, level, v...)
+}
+
+// LogfCtx is like Logf, and attaches the key/value pairs extracted from ctx
+// by the functions registered by RegisterContextExtractor.
+func (logger *Logger) LogfCtx(ctx context.Context, level Level, format string, v ...interface{}) {
+	logger.logfCtx(ctx, level, format, v...)
+}
+
+// Other quick commands with context for different level
+
+func (logger *Logger) CriticalCtx(ctx context.Context, v ...interface{}) {
+	logger.logCtx(ctx, CRITICAL, v...)
+}
+
+func (logger *Logger) FatalCtx(ctx context.Context, v ...interface{}) {
+	logger.logCtx(ctx, FATAL, v...)
+	logger.fatal()
+}
+
+func (logger *Logger) PanicCtx(ctx context.Context, v ...interface{}) {
+	logger.logCtx(ctx, CRITICAL, v...)
+	logger.panic(fmt.Sprint(v...))
+}
+
+func (logger *Logger) ErrorCtx(ctx context.Context, v ...interface{}) {
+	logger.logCtx(ctx, ERROR, v...)
+}
+
+func (logger *Logger) WarnCtx(ctx context.Context, v ...interface{}) {
+	logger.logCtx(ctx, WARNING, v...)
+}
+
+func (logger *Logger) WarningCtx(ctx context.Context, v ...interface{}) {
+	logger.logCtx(ctx, WARNING, v...)
+}
+
+func (logger *Logger) InfoCtx(ctx context.Context, v ...interface{}) {
+	logger.logCtx(ctx, INFO, v...)
+}
+
+func (logger *Logger) DebugCtx(ctx context.Context, v ...interface{}) {
+	logger.logCtx(ctx, DEBUG, v...)
+}
+
+func (logger *Logger) NotsetCtx(ctx context.Context, v ...interface{}) {
+	logger.logCtx(ctx, NOTSET, v...)
+}
+
+func (logger *Logger) CriticalfCtx(ctx context.Context, format string, v ...interface{}) {
+	logger.logfCtx(ctx, CRITICAL, format, v...)
+}
+
+func (logger *Logger) FatalfCtx(ctx context.Context, format string, v ...interface{}) {
+	logger.logfCtx(ctx, FATAL, format, v...)
+	logger.fatal()
+}
+
+func (logger *Logger) PanicfCtx(ctx context.Context, format string, v ...interface{}) {
+	logger.logfCtx(ctx, CRITICAL, format, v...)
+	logger.panic(fmt.Sprintf(format, v...))
+}
+
+func (logger *Logger) ErrorfCtx(ctx context.Context, format string, v ...interface{}) {
+	logger.logfCtx(ctx, ERROR, format, v...)
+}
+
+func (logger *Logger) WarnfCtx(ctx context.Context, format string, v ...interface{}) {
+	logger.logfCtx(ctx, WARNING, format, v...)
+}
+
+func (logger *Logger) WarningfCtx(ctx context.Context, format string, v ...interface{}) {
+	logger.logfCtx(ctx, WARNING, format, v...)
+}
+
+func (logger *Logger) InfofCtx(ctx context.Context, format string, v ...interface{}) {
+	logger.logfCtx(ctx, INFO, format, v...)
+}
+
+func (logger *Logger) DebugfCtx(ctx context.Context, format string, v ...interface{}) {
+	logger.logfCtx(ctx, DEBUG, format, v...)
+}
+
+func (logger *Logger) NotsetfCtx(ctx context.Context, format string, v ...interface{}) {
+	logger.logfCtx(ctx, NOTSET, format, v...)
+}
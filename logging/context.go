@@ -0,0 +1,96 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"context"
+	"sync"
+)
+
+// contextKey is the key of the logger in a context.Context.
+type contextKey struct{}
+
+// NewContext returns a copy of ctx which carries logger.
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the root logger returned
+// by GetLogger("") if there is none.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(*Logger); ok {
+			return logger
+		}
+	}
+	return GetLogger("")
+}
+
+// extractors holds the functions registered by RegisterContextExtractor.
+var extractors struct {
+	sync.RWMutex
+	funcs []func(ctx context.Context) []interface{}
+}
+
+// RegisterContextExtractor registers a function which extracts key/value
+// pairs, such as a request id or a trace id, from the context given to the
+// logging functions with the Ctx suffix. The pairs are attached to the
+// records after the ones attached by With.
+//
+// Example:
+//
+//	logging.RegisterContextExtractor(func(ctx context.Context) []interface{} {
+//		if id, ok := ctx.Value(requestIDKey).(string); ok {
+//			return []interface{}{"request_id", id}
+//		}
+//		return nil
+//	})
+func RegisterContextExtractor(fn func(ctx context.Context) []interface{}) {
+	extractors.Lock()
+	defer extractors.Unlock()
+	extractors.funcs = append(extractors.funcs, fn)
+}
+
+// extractContext appends the key/value pairs extracted from ctx to context.
+func extractContext(context []interface{}, ctx context.Context) []interface{} {
+	if ctx == nil {
+		return context
+	}
+	// the extractors run without the lock, so that they can register
+	// extractors themselves; funcs is only appended to
+	extractors.RLock()
+	funcs := extractors.funcs
+	extractors.RUnlock()
+	extracted := false
+	for _, fn := range funcs {
+		kv := fn(ctx)
+		if len(kv) == 0 {
+			continue
+		}
+		if !extracted {
+			// copy, as context is shared by the loggers derived by With
+			context = append([]interface{}(nil), context...)
+			extracted = true
+		}
+		context = append(context, kv...)
+		if len(kv)%2 != 0 {
+			// the last key has no value
+			context = append(context, errString)
+		}
+	}
+	return context
+}
@@ -0,0 +1,102 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// Encoder encodes records for handlers, as an alternative to the printf-style
+// record format.
+type Encoder interface {
+	// Encode writes the record, without a trailing newline, to the
+	// buffer.
+	Encode(b *bytes.Buffer, r *Record)
+	// Runtime reports whether the encoder uses the runtime fields of
+	// records.
+	Runtime() bool
+}
+
+// encoderFields lists the fields in the order they are written by encoders
+// if no field is given. The priority field is not listed, so that the default
+// output stays the same as before it was added, and is written only if given.
+var encoderFields = []string{
+	"name",
+	"seqid",
+	"levelno",
+	"levelname",
+	"created",
+	"nsecs",
+	"time",
+	"timestamp",
+	"rtime",
+	"filename",
+	"pathname",
+	"module",
+	"lineno",
+	"funcname",
+	"process",
+	"message",
+	"ctx",
+}
+
+// parseFields checks the field names given to an encoder, and returns the
+// names, the functions of the fields, and whether any of them is a runtime
+// field. All the fields are used if names is empty.
+func parseFields(names []string) ([]string, []fieldFunc, bool, error) {
+	if len(names) == 0 {
+		fieldsLock.RLock()
+		names = append([]string(nil), encoderFields...)
+		fieldsLock.RUnlock()
+	} else {
+		names = append([]string(nil), names...)
+	}
+	funcs := make([]fieldFunc, len(names))
+	runtime := false
+	for i, name := range names {
+		fn, rt, ok := lookupField(name)
+		if !ok {
+			return nil, nil, false, errors.New("logging field error: " + name)
+		}
+		funcs[i] = fn
+		runtime = runtime || rt
+	}
+	return names, funcs, runtime, nil
+}
+
+// newEncoder creates the encoder of a kind, "json" or "logfmt", from a comma
+// separated list of fields. It returns nil for the kind "", which means the
+// record format is used.
+func newEncoder(kind string, names string) (Encoder, error) {
+	var list []string
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			list = append(list, name)
+		}
+	}
+	switch kind {
+	case "":
+		return nil, nil
+	case "json":
+		return NewJSONEncoder(list...)
+	case "logfmt":
+		return NewLogfmtEncoder(list...)
+	}
+	return nil, errors.New("logging encoder error: " + kind)
+}
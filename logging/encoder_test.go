@@ -0,0 +1,92 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := WriterLogger("test", DEBUG, BasicFormat, DefaultTimeFormat, &buf, true)
+	encoder, _ := NewJSONEncoder("name", "levelname", "funcname", "message", "ctx")
+	encoder.SetKey("levelname", "level")
+	logger.SetEncoder(encoder)
+	logger.With("err", errors.New("boom"), "n", 1.5).Error("a \"quoted\"\n\x01\u2028\xff")
+	expected := `{"name":"test","level":"ERROR","funcname":"TestJSONEncoder","message":"a \"quoted\"\n\u0001\u2028\ufffd","ctx":{"err":"boom","n":1.5}}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("%s, %s\n", buf.String(), expected)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Errorf("%v\n", err)
+	}
+	if _, err := NewJSONEncoder("unknown"); err == nil {
+		t.Errorf("%v\n", err)
+	}
+	encoder, _ = NewJSONEncoder()
+	if len(encoder.Fields()) != len(fields)-1 || !encoder.Runtime() {
+		t.Errorf("%v, %v\n", encoder.Fields(), encoder.Runtime())
+	}
+	for _, name := range encoder.Fields() {
+		if name == "priority" {
+			t.Errorf("%v\n", encoder.Fields())
+		}
+	}
+	logger.Destroy()
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := WriterLogger("test", DEBUG, BasicFormat, DefaultTimeFormat, &buf, true)
+	encoder, _ := NewLogfmtEncoder("levelname", "message", "ctx")
+	encoder.SetKey("levelname", "level")
+	logger.SetEncoder(encoder)
+	logger.With("user", "bob", "a key", "x=y", "empty", "", "n", nil).Info("two\nlines")
+	logger.Info("plain")
+	expected := `level=INFO message="two\nlines" user=bob a_key="x=y" empty="" n=null` + "\n" +
+		"level=INFO message=plain\n"
+	if buf.String() != expected {
+		t.Errorf("%q, %q\n", buf.String(), expected)
+	}
+	logger.Destroy()
+}
+
+func TestConfigEncoder(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logging")
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "logging.conf")
+	file := filepath.Join(dir, "logging.log")
+	ioutil.WriteFile(conf, []byte("name = conf\nsync = 1\nencoder = logfmt\nfields = name, message\nfile = "+file+"\n"), 0644)
+	logger, err := ConfigLogger(conf)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	logger.Error("hello world")
+	logger.Destroy()
+	data, _ := ioutil.ReadFile(file)
+	expected := "name=conf message=\"hello world\"\n"
+	if string(data) != expected {
+		t.Errorf("%q, %q\n", data, expected)
+	}
+}
@@ -17,36 +17,53 @@
 package logging
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/kardianos/osext"
 	"os"
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
-// The struct for each log record
-type record struct {
-	level    Level
-	seqid    uint64
-	pathname string
-	filename string
-	module   string
-	lineno   int
-	funcname string
-	thread   int
-	process  int
-	message  string
-	time     time.Time
+// Record is the struct for each log record. It is created by the logger that
+// receives the log request and passed to the handlers.
+type Record struct {
+	logger     *Logger       // logger that created the record
+	level      Level         // level of the record
+	seqid      uint64        // sequence number in the logger
+	format     string        // format of the message, "" for fmt.Sprint
+	args       []interface{} // arguments of the message
+	formatted  bool          // message is generated or not
+	pc         uintptr       // caller of the logging function, 0 if unknown
+	file       string        // file of the caller
+	line       int           // line of the caller
+	pathname   string
+	filename   string
+	module     string
+	lineno     int
+	funcname   string
+	thread     int
+	process    int
+	message    string
+	time       time.Time
+	context    []interface{} // key/value pairs of the logger
+	timeFormat string        // time format of the handler
 }
 
+// fieldFunc generates the value of a field for a record.
+type fieldFunc func(*Logger, *Record) interface{}
+
 // This variable maps fields in recordArgs to relavent function signatures
-var fields = map[string]func(*Logger, *record) interface{}{
+var fields = map[string]fieldFunc{
 	"name":      (*Logger).lname,     // name of the logger
 	"seqid":     (*Logger).nextSeqid, // sequence number
 	"levelno":   (*Logger).levelno,   // level number
 	"levelname": (*Logger).levelname, // level name
+	"priority":  (*Logger).priority,  // syslog severity of the level
 	"created":   (*Logger).created,   // starting time of the logger
 	"nsecs":     (*Logger).nsecs,     // nanosecond of the starting time
 	"time":      (*Logger).time,      // record created time
@@ -59,6 +76,7 @@ var fields = map[string]func(*Logger, *record) interface{}{
 	"funcname":  (*Logger).funcname,  // function name of the caller
 	"process":   (*Logger).process,   // process id
 	"message":   (*Logger).message,   // logger message
+	"ctx":       (*Logger).ctx,       // key/value pairs attached by With
 }
 
 var runtimeFields = map[string]bool{
@@ -66,6 +84,7 @@ var runtimeFields = map[string]bool{
 	"seqid":     false,
 	"levelno":   false,
 	"levelname": false,
+	"priority":  false,
 	"created":   false,
 	"nsecs":     false,
 	"time":      false,
@@ -79,6 +98,45 @@ var runtimeFields = map[string]bool{
 	"thread":    true,
 	"process":   false,
 	"message":   false,
+	"ctx":       false,
+}
+
+// fieldsLock protects fields, runtimeFields, and encoderFields, which are
+// read when formats are parsed and written by RegisterField.
+var fieldsLock sync.RWMutex
+
+// RegisterField registers a custom field, which can then be used in record
+// formats and encoders like the pre-defined ones. The fn returns the value of
+// the field for a record, and needsRuntime tells whether fn uses the runtime
+// information of the record, such as Filename or Funcname. Registering an
+// existing name replaces the field for the formats parsed afterwards.
+//
+// Example:
+//
+//	logging.RegisterField("goroutines", func(r *logging.Record) interface{} {
+//		return runtime.NumGoroutine()
+//	}, false)
+//	logger, _ := logging.WriterLogger("main", logging.INFO,
+//		"{time} {goroutines} {message}", logging.DefaultTimeFormat, os.Stdout, false)
+func RegisterField(name string, fn func(*Record) interface{}, needsRuntime bool) {
+	fieldsLock.Lock()
+	defer fieldsLock.Unlock()
+	if _, ok := fields[name]; !ok {
+		encoderFields = append(encoderFields, name)
+	}
+	fields[name] = func(logger *Logger, r *Record) interface{} {
+		return fn(r)
+	}
+	runtimeFields[name] = needsRuntime
+}
+
+// lookupField returns the function of a field and whether it is a runtime
+// field.
+func lookupField(name string) (fieldFunc, bool, bool) {
+	fieldsLock.RLock()
+	defer fieldsLock.RUnlock()
+	fn, ok := fields[name]
+	return fn, runtimeFields[name], ok
 }
 
 // If it fails to get some fields with string type, these fields are set to
@@ -92,16 +150,18 @@ func getShortFuncName(fname string) string {
 }
 
 // genRuntime generates the runtime information, including pathname, function
-// name, filename, line number.
-func (r *record) genRuntime() {
-	calldepth := 4
-	pc, file, line, ok := runtime.Caller(calldepth)
-	if ok {
-		fname := runtime.FuncForPC(pc).Name()
-		r.pathname = file
+// name, filename, line number, from the caller recorded by the logger.
+func (r *Record) genRuntime() {
+	if r.pathname != "" {
+		// already generated
+		return
+	}
+	if r.pc != 0 {
+		fname := runtime.FuncForPC(r.pc).Name()
+		r.pathname = r.file
 		r.funcname = getShortFuncName(fname)
-		r.filename = path.Base(file)
-		r.lineno = line
+		r.filename = path.Base(r.file)
+		r.lineno = r.line
 	} else {
 		r.pathname = errString
 		r.funcname = errString
@@ -115,89 +175,171 @@ func (r *record) genRuntime() {
 
 // genNonRuntime generates the non-runtime information, including sequential
 // id and time.
-func (r *record) genNonRuntime(logger *Logger) {
+func (r *Record) genNonRuntime(logger *Logger) {
+	r.logger = logger
 	r.seqid = atomic.AddUint64(&(logger.seqid), 1)
 	r.time = time.Now()
 }
 
+// genMessage generates the message from the format and arguments.
+func (r *Record) genMessage() {
+	if !r.formatted {
+		if r.format == "" {
+			r.message = fmt.Sprint(r.args...)
+		} else {
+			r.message = fmt.Sprintf(r.format, r.args...)
+		}
+		r.formatted = true
+	}
+}
+
+// Getter functions of the record. The runtime information is only available
+// if some handler of the logger needs runtime fields.
+
+func (r *Record) Logger() *Logger {
+	return r.logger
+}
+
+func (r *Record) Name() string {
+	return r.logger.name
+}
+
+func (r *Record) Level() Level {
+	return r.level
+}
+
+func (r *Record) Seqid() uint64 {
+	return r.seqid
+}
+
+func (r *Record) Time() time.Time {
+	return r.time
+}
+
+func (r *Record) Message() string {
+	r.genMessage()
+	return r.message
+}
+
+func (r *Record) Context() []interface{} {
+	return r.context
+}
+
+func (r *Record) Pathname() string {
+	r.genRuntime()
+	return r.pathname
+}
+
+func (r *Record) Filename() string {
+	r.genRuntime()
+	return r.filename
+}
+
+func (r *Record) Funcname() string {
+	r.genRuntime()
+	return r.funcname
+}
+
+func (r *Record) Lineno() int {
+	r.genRuntime()
+	return r.lineno
+}
+
 // Logger name
-func (logger *Logger) lname(r *record) interface{} {
+func (logger *Logger) lname(r *Record) interface{} {
 	return logger.name
 }
 
 // Next sequence number
-func (logger *Logger) nextSeqid(r *record) interface{} {
+func (logger *Logger) nextSeqid(r *Record) interface{} {
 	return r.seqid
 }
 
 // Log level number
-func (logger *Logger) levelno(r *record) interface{} {
+func (logger *Logger) levelno(r *Record) interface{} {
 	return int32(r.level)
 }
 
 // Log level name
-func (logger *Logger) levelname(r *record) interface{} {
-	return levelNames[r.level]
+func (logger *Logger) levelname(r *Record) interface{} {
+	return GetLevelName(r.level)
+}
+
+// Syslog severity of the level
+func (logger *Logger) priority(r *Record) interface{} {
+	return SyslogSeverity(r.level)
 }
 
 // File name of calling logger, with whole path
-func (logger *Logger) pathname(r *record) interface{} {
-	return r.pathname
+func (logger *Logger) pathname(r *Record) interface{} {
+	return r.Pathname()
 }
 
 // File name of calling logger
-func (logger *Logger) filename(r *record) interface{} {
-	return r.filename
+func (logger *Logger) filename(r *Record) interface{} {
+	return r.Filename()
 }
 
 // module name
-func (logger *Logger) module(r *record) interface{} {
+func (logger *Logger) module(r *Record) interface{} {
 	module, _ := osext.Executable()
 	return path.Base(module)
 }
 
 // Line number
-func (logger *Logger) lineno(r *record) interface{} {
-	return r.lineno
+func (logger *Logger) lineno(r *Record) interface{} {
+	return r.Lineno()
 }
 
 // Function name
-func (logger *Logger) funcname(r *record) interface{} {
-	return r.funcname
+func (logger *Logger) funcname(r *Record) interface{} {
+	return r.Funcname()
 }
 
 // Timestamp of starting time
-func (logger *Logger) created(r *record) interface{} {
+func (logger *Logger) created(r *Record) interface{} {
 	return logger.startTime.UnixNano()
 }
 
 // RFC3339Nano time
-func (logger *Logger) time(r *record) interface{} {
-	return r.time.Format(logger.timeFormat)
+func (logger *Logger) time(r *Record) interface{} {
+	return r.time.Format(r.timeFormat)
 }
 
 // Nanosecond of starting time
-func (logger *Logger) nsecs(r *record) interface{} {
+func (logger *Logger) nsecs(r *Record) interface{} {
 	return logger.startTime.Nanosecond()
 }
 
 // Nanosecond timestamp
-func (logger *Logger) timestamp(r *record) interface{} {
+func (logger *Logger) timestamp(r *Record) interface{} {
 	return r.time.UnixNano()
 }
 
 // Nanoseconds since logger created
-func (logger *Logger) rtime(r *record) interface{} {
+func (logger *Logger) rtime(r *Record) interface{} {
 	return r.time.Sub(logger.startTime).Nanoseconds()
 }
 
 // Process ID
-func (logger *Logger) process(r *record) interface{} {
+func (logger *Logger) process(r *Record) interface{} {
 	r.process = os.Getpid()
 	return r.process
 }
 
 // The log message
-func (logger *Logger) message(r *record) interface{} {
-	return r.message
+func (logger *Logger) message(r *Record) interface{} {
+	return r.Message()
+}
+
+// Key/value pairs attached to the logger
+func (logger *Logger) ctx(r *Record) interface{} {
+	var buf bytes.Buffer
+	for i := 0; i+1 < len(r.context); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		fmt.Fprint(&buf, r.context[i], "=", r.context[i+1])
+	}
+	return buf.String()
 }
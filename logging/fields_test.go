@@ -17,15 +17,18 @@
 package logging
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestSeqid(t *testing.T) {
 	logger, _ := BasicLogger("test")
 	for i := 0; i < 1000; i++ {
-		r := new(record)
+		r := new(Record)
 		r.genNonRuntime(logger)
 		name := strconv.Itoa(i + 1)
 		seq := logger.nextSeqid(r)
@@ -39,9 +42,151 @@ func TestSeqid(t *testing.T) {
 func TestName(t *testing.T) {
 	name := "test"
 	logger, _ := BasicLogger(name)
-	r := new(record)
+	r := new(Record)
 	if logger.lname(r) != name {
 		t.Errorf("%v, %v\n", logger.lname(r), name)
 	}
 	logger.Destroy()
 }
+
+func TestWith(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := WriterLogger("test", DEBUG, "%s [%s]\n message,ctx", DefaultTimeFormat, &buf, true)
+	child := logger.With("request_id", 42, "user", "alice")
+	child.With("odd").Info("hello")
+	logger.Info("plain")
+	expected := "hello [request_id=42 user=alice odd=???]\nplain []\n"
+	if buf.String() != expected {
+		t.Errorf("%q, %q\n", buf.String(), expected)
+	}
+	logger.Destroy()
+}
+
+func TestPlanFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := WriterLogger("test", DEBUG, "{{{levelname:6}}} {levelname:<6}|{name:^8}|{seqid:-3}|{message}", DefaultTimeFormat, &buf, true)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	logger.Info("hello")
+	expected := "{  INFO} INFO  |  test  |1  |hello\n"
+	if buf.String() != expected {
+		t.Errorf("%q, %q\n", buf.String(), expected)
+	}
+	args := logger.RecordArgs()
+	if len(args) != 5 || args[4] != "message" {
+		t.Errorf("%v\n", args)
+	}
+	logger.Destroy()
+	for _, format := range []string{"{unknown}", "{message", "message}", "{message:x}", "%s %s\n message", "%s\n message,name", "%s - %s", "plain text", ""} {
+		if logger, err := WriterLogger("test", DEBUG, format, DefaultTimeFormat, &buf, true); err == nil {
+			t.Errorf("%q\n", format)
+			logger.Destroy()
+		}
+	}
+	for _, format := range []string{BasicFormat, RichFormat, "%s %%d %[1]s\n message", "%*d\n seqid,lineno"} {
+		if logger, err := WriterLogger("test", DEBUG, format, DefaultTimeFormat, &buf, true); err != nil {
+			t.Errorf("%q, %v\n", format, err)
+		} else {
+			logger.Destroy()
+		}
+	}
+}
+
+func TestRegisterField(t *testing.T) {
+	RegisterField("tenant", func(r *Record) interface{} {
+		context := r.Context()
+		for i := 0; i+1 < len(context); i += 2 {
+			if context[i] == "tenant" {
+				return context[i+1]
+			}
+		}
+		return "-"
+	}, false)
+	RegisterField("caller", func(r *Record) interface{} {
+		return r.Funcname()
+	}, true)
+	var buf bytes.Buffer
+	logger, err := WriterLogger("test", DEBUG, "%s %s %s\n tenant,caller,message", DefaultTimeFormat, &buf, true)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	encoder, _ := NewJSONEncoder("tenant", "message")
+	handler, _ := NewWriterHandler(NOTSET, "{tenant} {message}", DefaultTimeFormat, &buf, true)
+	handler.SetEncoder(encoder)
+	logger.With("tenant", "acme").Info("hello")
+	logger.AddHandler(handler)
+	logger.Info("world")
+	expected := "acme TestRegisterField hello\n- TestRegisterField world\n{\"tenant\":\"-\",\"message\":\"world\"}\n"
+	if buf.String() != expected {
+		t.Errorf("%q, %q\n", buf.String(), expected)
+	}
+	logger.Destroy()
+}
+
+type testKey struct{}
+
+func TestContext(t *testing.T) {
+	// restore the registered extractors for later tests
+	extractors.RLock()
+	funcs := extractors.funcs
+	extractors.RUnlock()
+	defer func() {
+		extractors.Lock()
+		extractors.funcs = funcs
+		extractors.Unlock()
+	}()
+	RegisterContextExtractor(func(ctx context.Context) []interface{} {
+		if id, ok := ctx.Value(testKey{}).(int); ok {
+			return []interface{}{"request_id", id}
+		}
+		return nil
+	})
+	var buf bytes.Buffer
+	logger, _ := WriterLogger("test", DEBUG, "{funcname} {message} [{ctx}]", DefaultTimeFormat, &buf, true)
+	ctx := NewContext(context.WithValue(context.Background(), testKey{}, 7), logger.With("user", "bob"))
+	FromContext(ctx).InfoCtx(ctx, "hello")
+	FromContext(ctx).ErrorfCtx(context.Background(), "%d", 1)
+	expected := "TestContext hello [user=bob request_id=7]\nTestContext 1 [user=bob]\n"
+	if buf.String() != expected {
+		t.Errorf("%q, %q\n", buf.String(), expected)
+	}
+	if FromContext(context.Background()) != GetLogger("") {
+		t.Errorf("%v, %v\n", FromContext(context.Background()), GetLogger(""))
+	}
+	GetLogger("").Destroy()
+	logger.Destroy()
+}
+
+func TestContextRegister(t *testing.T) {
+	extractors.RLock()
+	funcs := extractors.funcs
+	extractors.RUnlock()
+	// an extractor can register an extractor
+	registered := false
+	RegisterContextExtractor(func(ctx context.Context) []interface{} {
+		if !registered {
+			registered = true
+			RegisterContextExtractor(func(ctx context.Context) []interface{} {
+				return []interface{}{"late", 1}
+			})
+		}
+		return nil
+	})
+	done := make(chan []interface{})
+	go func() {
+		extractContext(nil, context.Background())
+		done <- extractContext(nil, context.Background())
+	}()
+	select {
+	case kv := <-done:
+		if len(kv) != 2 || kv[0] != "late" {
+			t.Errorf("%v\n", kv)
+		}
+		extractors.Lock()
+		extractors.funcs = funcs
+		extractors.Unlock()
+	case <-time.After(5 * time.Second):
+		t.Fatalf("deadlock\n")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileWriter is the writer of the file opened by a file handler, which is
+// closed when the handler is closed and can be reopened.
+type fileWriter interface {
+	io.WriteCloser
+	Reopen() error // close and reopen the file
+	moved() bool   // whether the path no longer refers to the opened file
+}
+
+// appendFile is a file opened for appending, which can be reopened.
+type appendFile struct {
+	lock   sync.Mutex
+	name   string   // name of the file
+	fd     *os.File // opened file
+	closed bool     // set when closed, to avoid reopening
+
+	archive *archiver // compresses and prunes the archives, if not nil
+}
+
+// openFile opens file for appending, creating it if needed.
+func openFile(file string) (*os.File, error) {
+	return os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, os.ModeAppend|0644)
+}
+
+// newAppendFile opens file for appending.
+func newAppendFile(file string) (*appendFile, error) {
+	fd, err := openFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return &appendFile{name: file, fd: fd}, nil
+}
+
+func (f *appendFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.fd.Write(p)
+}
+
+// Reopen closes and reopens the file.
+func (f *appendFile) Reopen() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.reopen()
+}
+
+// reopen reopens the file with the lock held.
+func (f *appendFile) reopen() error {
+	if f.closed {
+		return nil
+	}
+	fd, err := openFile(f.name)
+	if err != nil {
+		return err
+	}
+	old := f.fd
+	f.fd = fd
+	return old.Close()
+}
+
+func (f *appendFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.closed = true
+	if f.archive != nil {
+		close(f.archive.done)
+		f.archive = nil
+	}
+	return f.fd.Close()
+}
+
+func (f *appendFile) moved() bool {
+	f.lock.Lock()
+	opened, err := f.fd.Stat()
+	f.lock.Unlock()
+	if err != nil {
+		return true
+	}
+	current, err := os.Stat(f.name)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(opened, current)
+}
+
+// Reopen closes and reopens the file of a handler created by NewFileHandler,
+// e.g. after the file is moved by logrotate. Records queued by an async
+// handler are written to the new file. It does nothing for other handlers.
+func (handler *WriterHandler) Reopen() error {
+	if handler.fd == nil {
+		return nil
+	}
+	return handler.fd.Reopen()
+}
+
+// Watch makes a handler created by NewFileHandler check its file every
+// interval, and reopen it if the file is moved or removed, i.e., the path no
+// longer refers to the opened file. It stops when the handler is closed.
+func (handler *WriterHandler) Watch(interval time.Duration) {
+	if handler.fd == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if handler.fd.moved() {
+					handler.fd.Reopen()
+				}
+			case <-handler.done:
+				return
+			}
+		}
+	}()
+}
+
+// ReopenAll reopens the files of the handlers of all the loggers returned by
+// Loggers, and returns the first error.
+func ReopenAll() error {
+	var first error
+	for _, logger := range Loggers() {
+		for _, handler := range logger.Handlers() {
+			if h, ok := handler.(interface {
+				Reopen() error
+			}); ok {
+				if err := h.Reopen(); err != nil && first == nil {
+					first = err
+				}
+			}
+		}
+	}
+	return first
+}
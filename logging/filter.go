@@ -0,0 +1,186 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Filter decides whether a record is written. Filters can be added to loggers,
+// where they are checked once for the records the logger receives, and to
+// handlers, where they are checked for the records the handler writes. A
+// filter that looks at the caller of records, e.g. Filename or Funcname,
+// should also have a method Runtime() bool returning true, so that loggers
+// collect the runtime information for it.
+type Filter interface {
+	// Filter returns true if the record should be written.
+	Filter(r *Record) bool
+}
+
+// FilterFunc adapts an ordinary function to a Filter.
+type FilterFunc func(r *Record) bool
+
+// Filter calls f(r).
+func (f FilterFunc) Filter(r *Record) bool {
+	return f(r)
+}
+
+// runtimeFilter is implemented by the filters which need runtime fields.
+type runtimeFilter interface {
+	Runtime() bool
+}
+
+// filterRuntime reports whether a filter needs runtime fields.
+func filterRuntime(filters []Filter) bool {
+	for _, f := range filters {
+		if rf, ok := f.(runtimeFilter); ok && rf.Runtime() {
+			return true
+		}
+	}
+	return false
+}
+
+// filterRecord reports whether the record passes all the filters.
+func filterRecord(filters []Filter, r *Record) bool {
+	for _, f := range filters {
+		if !f.Filter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterList is a list of filters embedded by loggers and handlers. Filters
+// can be added while records are checked by other goroutines, because the
+// list is replaced rather than changed.
+type filterList struct {
+	lock sync.Mutex   // lock of adding filters
+	list atomic.Value // []Filter
+}
+
+// AddFilter adds a filter to the list.
+func (f *filterList) AddFilter(filter Filter) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	old := f.Filters()
+	filters := make([]Filter, len(old), len(old)+1)
+	copy(filters, old)
+	f.list.Store(append(filters, filter))
+}
+
+// Filters returns the filters in the list.
+func (f *filterList) Filters() []Filter {
+	filters, _ := f.list.Load().([]Filter)
+	return filters
+}
+
+// passes reports whether the record passes all the filters in the list.
+func (f *filterList) passes(r *Record) bool {
+	return filterRecord(f.Filters(), r)
+}
+
+// filtersRuntime reports whether a filter in the list needs runtime fields.
+func (f *filterList) filtersRuntime() bool {
+	return filterRuntime(f.Filters())
+}
+
+// nameFilter passes the records of a logger and its descendants.
+type nameFilter string
+
+// NameFilter returns a filter which passes the records of the loggers named
+// name and their descendants in the hierarchy, e.g. NameFilter("db") passes
+// "db" and "db.pool" but not "dbx".
+func NameFilter(name string) Filter {
+	return nameFilter(name)
+}
+
+func (f nameFilter) Filter(r *Record) bool {
+	name := r.Name()
+	prefix := string(f)
+	if prefix == "" || name == prefix {
+		return true
+	}
+	return strings.HasPrefix(name, prefix) && name[len(prefix)] == '.'
+}
+
+// messageFilter passes the records whose message matches a regexp.
+type messageFilter struct {
+	re *regexp.Regexp
+}
+
+// MessageFilter returns a filter which passes the records whose message
+// matches the regular expression expr.
+func MessageFilter(expr string) (Filter, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &messageFilter{re}, nil
+}
+
+func (f *messageFilter) Filter(r *Record) bool {
+	return f.re.MatchString(r.Message())
+}
+
+// callerFilter passes the records logged from some files or functions.
+type callerFilter struct {
+	file     string
+	function string
+}
+
+// CallerFilter returns a filter which passes the records whose caller matches
+// the shell patterns of path.Match. The file pattern is matched against the
+// filename of the caller, or against its pathname if the pattern contains a
+// slash, and the function pattern against the short function name. An empty
+// pattern matches everything.
+func CallerFilter(file string, function string) (Filter, error) {
+	// check the syntax of the patterns
+	if _, err := path.Match(file, ""); err != nil {
+		return nil, err
+	}
+	if _, err := path.Match(function, ""); err != nil {
+		return nil, err
+	}
+	return &callerFilter{file, function}, nil
+}
+
+func (f *callerFilter) Filter(r *Record) bool {
+	if f.file != "" {
+		name := r.Filename()
+		if strings.Contains(f.file, "/") {
+			name = r.Pathname()
+		}
+		if ok, _ := path.Match(f.file, name); !ok {
+			return false
+		}
+	}
+	if f.function != "" {
+		if ok, _ := path.Match(f.function, r.Funcname()); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Runtime returns true as the filter uses the caller of records.
+func (f *callerFilter) Runtime() bool {
+	return true
+}
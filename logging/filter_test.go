@@ -0,0 +1,46 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFilters(t *testing.T) {
+	var buf bytes.Buffer
+	root, _ := WriterLogger("", NOTSET, "%s %s\n name,message", DefaultTimeFormat, &buf, true)
+	message, _ := MessageFilter("^keep")
+	root.Handler().AddFilter(message)
+	db := root.GetChild("db")
+	db.AddFilter(NameFilter("db"))
+	db.Info("keep db")
+	db.GetChild("pool").Info("keep db.pool")
+	root.GetChild("dbx").Info("keep dbx")
+	db.Info("drop db")
+	caller, _ := CallerFilter("filter_test.go", "TestF*")
+	db.AddFilter(caller)
+	db.Info("keep caller")
+	caller, _ = CallerFilter("*/other.go", "")
+	db.AddFilter(caller)
+	db.Info("keep other")
+	expected := "db keep db\ndb.pool keep db.pool\ndbx keep dbx\ndb keep caller\n"
+	if buf.String() != expected {
+		t.Errorf("%q, %q\n", buf.String(), expected)
+	}
+	root.Destroy()
+}
@@ -0,0 +1,275 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FluentConfig configures a FluentHandler.
+type FluentConfig struct {
+	Network      string        // network of the collector, "tcp" if ""
+	Addr         string        // address of the collector
+	TagPrefix    string        // prefix of tags, which are the logger names prefixed by TagPrefix and a dot, and the tag of the root logger
+	RequireAck   bool          // require acks of chunks for at-least-once delivery
+	Timeout      time.Duration // timeout of connecting, writing and waiting for an ack, DefaultNetTimeout if 0
+	BufferSize   int           // maximum records in a batch, DefaultBufferSize if 0
+	TimeInterval time.Duration // maximum milliseconds to wait for a batch, DefaultTimeInterval if 0
+	MaxRetries   int           // maximum retries of a chunk, 5 if 0
+	Errors       chan<- error  // channel receiving errors, which are dropped if it is full or nil
+}
+
+// FluentHandler is a handler that ships records in batches to a Fluentd or
+// Fluent Bit collector by the Forward protocol. Records of a batch are
+// grouped by the logger name, which is the tag, and each group is sent as a
+// message in PackedForward mode, whose entries are [time, record] with the
+// time as EventTime and the record as a map of the level, message and
+// context fields. The tag of the root logger is TagPrefix, or the program
+// name without TagPrefix. If RequireAck is set, each message carries a chunk id and
+// is resent until the collector acks it, so that records are delivered at
+// least once. A broken connection is reconnected with exponential backoff,
+// and a message is dropped after MaxRetries retries. Records wait in a queue
+// handling the overflow like the one of an async WriterHandler, see
+// SetOverflow.
+type FluentHandler struct {
+	level      Level // record level higher than this will be shipped
+	filterList       // filters to check records
+	config     FluentConfig
+	conn       net.Conn // used by the goroutine of the batcher until it quits
+
+	*batcher
+}
+
+// NewFluentHandler creates a new handler shipping records by the Forward
+// protocol. It connects on the first batch.
+func NewFluentHandler(level Level, config FluentConfig) (*FluentHandler, error) {
+	if config.Addr == "" {
+		return nil, errors.New("logging fluent error: no address")
+	}
+	if config.Network == "" {
+		config.Network = "tcp"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultNetTimeout
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = DefaultBufferSize
+	}
+	if config.TimeInterval <= 0 {
+		config.TimeInterval = DefaultTimeInterval
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = 5
+	}
+	handler := &FluentHandler{level: level, config: config}
+	handler.batcher = newBatcher(config.BufferSize, config.TimeInterval, handler.send)
+	return handler, nil
+}
+
+// Handle queues the record if its level is not lower than the level of the
+// handler and it passes all the filters of the handler.
+func (handler *FluentHandler) Handle(r *Record) {
+	if r.level < handler.Level() || !handler.passes(r) {
+		return
+	}
+	handler.push(r)
+}
+
+// send sends a batch as a message for each tag.
+func (handler *FluentHandler) send(batch []Record) {
+	var tags []string
+	entries := make(map[string]*bytes.Buffer)
+	sizes := make(map[string]int)
+	for i := range batch {
+		r := &batch[i]
+		tag := handler.tag(r.Name())
+		b, ok := entries[tag]
+		if !ok {
+			b = new(bytes.Buffer)
+			entries[tag] = b
+			tags = append(tags, tag)
+		}
+		writeFluentEntry(b, r)
+		sizes[tag]++
+	}
+	for _, tag := range tags {
+		handler.forward(tag, entries[tag].Bytes(), sizes[tag])
+	}
+}
+
+// tag returns the tag of records of the logger name, which is the name after
+// TagPrefix and a dot, or TagPrefix or the program name for the root logger.
+func (handler *FluentHandler) tag(name string) string {
+	prefix := handler.config.TagPrefix
+	switch {
+	case name == "" && prefix == "":
+		return filepath.Base(os.Args[0])
+	case name == "":
+		return prefix
+	case prefix == "":
+		return name
+	}
+	return prefix + "." + name
+}
+
+// forward sends a message of packed entries, retrying it with exponential
+// backoff.
+func (handler *FluentHandler) forward(tag string, entries []byte, size int) {
+	var chunk string
+	if handler.config.RequireAck {
+		var id [16]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			reportError(handler.config.Errors, err)
+			return
+		}
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+	}
+	var b bytes.Buffer
+	writeMsgpackArray(&b, 3)
+	writeMsgpackString(&b, tag)
+	writeMsgpackBin(&b, entries)
+	if chunk != "" {
+		writeMsgpackMap(&b, 2)
+		writeMsgpackString(&b, "chunk")
+		writeMsgpackString(&b, chunk)
+	} else {
+		writeMsgpackMap(&b, 1)
+	}
+	writeMsgpackString(&b, "size")
+	writeMsgpackInt(&b, int64(size))
+	err := retryBackoff(handler.config.MaxRetries, handler.done, func() (bool, error) {
+		err := handler.write(b.Bytes(), chunk)
+		if err != nil && handler.conn != nil {
+			handler.conn.Close()
+			handler.conn = nil
+		}
+		return true, err
+	})
+	if err != nil {
+		reportError(handler.config.Errors, fmt.Errorf("logging fluent error: %d records of %s dropped: %v", size, tag, err))
+	}
+}
+
+// write writes a message, connecting first if needed, and waits for the ack
+// of the chunk if it is not "".
+func (handler *FluentHandler) write(msg []byte, chunk string) error {
+	if handler.conn == nil {
+		conn, err := net.DialTimeout(handler.config.Network, handler.config.Addr, handler.config.Timeout)
+		if err != nil {
+			return err
+		}
+		handler.conn = conn
+	}
+	handler.conn.SetDeadline(time.Now().Add(handler.config.Timeout))
+	if _, err := handler.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+	ack, err := readFluentAck(handler.conn)
+	if err != nil {
+		return err
+	}
+	if ack != chunk {
+		return fmt.Errorf("logging fluent error: invalid ack %q", ack)
+	}
+	return nil
+}
+
+// maxFluentAck is the maximum size in bytes of an ack.
+const maxFluentAck = 4096
+
+// readFluentAck reads an ack, which is a map of the only key "ack" to a chunk
+// id. At most maxFluentAck bytes are read, so that an invalid ack can't make
+// the handler take much memory.
+func readFluentAck(r io.Reader) (string, error) {
+	resp, err := readMsgpack(bufio.NewReader(io.LimitReader(r, maxFluentAck)))
+	if err != nil {
+		return "", fmt.Errorf("logging fluent error: invalid ack: %v", err)
+	}
+	m, ok := resp.(map[interface{}]interface{})
+	ack, isString := m["ack"].(string)
+	if !ok || len(m) != 1 || !isString {
+		return "", fmt.Errorf("logging fluent error: invalid ack %v", resp)
+	}
+	return ack, nil
+}
+
+// writeFluentEntry writes a record as an entry of [time, record].
+func writeFluentEntry(b *bytes.Buffer, r *Record) {
+	writeMsgpackArray(b, 2)
+	writeMsgpackEventTime(b, r.Time())
+	keys := make([]string, 0, len(r.context)/2)
+	values := make([]interface{}, 0, len(r.context)/2)
+	for i := 0; i+1 < len(r.context); i += 2 {
+		// Context keys must not repeat the keys of the level and the
+		// message, which a map can only hold once.
+		key := fmt.Sprint(r.context[i])
+		if key == "level" || key == "message" {
+			continue
+		}
+		keys = append(keys, key)
+		values = append(values, r.context[i+1])
+	}
+	writeMsgpackMap(b, 2+len(keys))
+	writeMsgpackString(b, "level")
+	writeMsgpackString(b, r.level.String())
+	writeMsgpackString(b, "message")
+	writeMsgpackString(b, r.Message())
+	for i, key := range keys {
+		writeMsgpackString(b, key)
+		writeMsgpackValue(b, values[i])
+	}
+}
+
+// Close sends the queued records and closes the connection.
+func (handler *FluentHandler) Close() {
+	handler.batcher.Close()
+	if handler.conn != nil {
+		handler.conn.Close()
+		handler.conn = nil
+	}
+}
+
+// Runtime reports whether a filter has runtime fields.
+func (handler *FluentHandler) Runtime() bool {
+	return handler.filtersRuntime()
+}
+
+// Getter functions
+
+func (handler *FluentHandler) Level() Level {
+	return Level(atomic.LoadInt32((*int32)(&handler.level)))
+}
+
+// Setter functions
+
+func (handler *FluentHandler) SetLevel(level Level) {
+	atomic.StoreInt32((*int32)(&handler.level), int32(level))
+}
@@ -0,0 +1,178 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMsgpack(t *testing.T) {
+	var b bytes.Buffer
+	values := []interface{}{nil, true, -1, -200, 100000, uint64(1) << 40, 1.5, "s", []byte("b"), []interface{}{int64(1)}}
+	writeMsgpackArray(&b, len(values))
+	for _, v := range values[:len(values)-1] {
+		writeMsgpackValue(&b, v)
+	}
+	writeMsgpackArray(&b, 1)
+	writeMsgpackValue(&b, 1)
+	v, err := readMsgpack(bufio.NewReader(&b))
+	a, ok := v.([]interface{})
+	if err != nil || !ok || len(a) != len(values) || a[0] != nil || a[1] != true || a[2] != int64(-1) || a[3] != int64(-200) ||
+		a[4] != uint64(100000) || a[5] != uint64(1)<<40 || a[6] != 1.5 || a[7] != "s" || string(a[8].([]byte)) != "b" {
+		t.Errorf("%v %v\n", v, err)
+	}
+}
+
+func TestFluentHandler(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer ln.Close()
+	messages := make(chan []interface{}, 4)
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			for {
+				v, err := readMsgpack(r)
+				if err != nil {
+					break
+				}
+				msg := v.([]interface{})
+				messages <- msg
+				if i == 0 {
+					break
+				}
+				var b bytes.Buffer
+				writeMsgpackMap(&b, 1)
+				writeMsgpackString(&b, "ack")
+				writeMsgpackValue(&b, msg[2].(map[interface{}]interface{})["chunk"])
+				conn.Write(b.Bytes())
+			}
+			conn.Close()
+		}
+	}()
+
+	logger, _ := WriterLogger("fluent", DEBUG, BasicFormat, DefaultTimeFormat, ioutil.Discard, true)
+	defer logger.Destroy()
+	handler, err := NewFluentHandler(INFO, FluentConfig{Addr: ln.Addr().String(), TagPrefix: "app", RequireAck: true, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	logger.AddHandler(handler)
+	logger.Debug("dropped")
+	logger.With("user", "alice").Info("first")
+	logger.Error("second")
+	logger.Flush()
+	handler.Close()
+
+	first, second := <-messages, <-messages
+	option := second[2].(map[interface{}]interface{})
+	if first[2].(map[interface{}]interface{})["chunk"] != option["chunk"] || option["size"] != int64(2) || second[0] != "app.fluent" {
+		t.Fatalf("%v %v\n", first, second)
+	}
+	r := bufio.NewReader(bytes.NewReader(second[1].([]byte)))
+	for _, want := range []string{"INFO first alice", "ERROR second <nil>"} {
+		v, err := readMsgpack(r)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		entry := v.([]interface{})
+		ext, ok := entry[0].(msgpackExt)
+		record := entry[1].(map[interface{}]interface{})
+		got := record["level"].(string) + " " + record["message"].(string) + " "
+		if user, ok := record["user"].(string); ok {
+			got += user
+		} else {
+			got += "<nil>"
+		}
+		if !ok || ext.Type != 0 || len(ext.Data) != 8 || got != want {
+			t.Errorf("%v\n", entry)
+		}
+	}
+}
+
+func TestFluentTag(t *testing.T) {
+	handler, _ := NewFluentHandler(INFO, FluentConfig{Addr: "127.0.0.1:0"})
+	defer handler.Close()
+	program := filepath.Base(os.Args[0])
+	if handler.tag("") != program || handler.tag("db") != "db" {
+		t.Errorf("%q, %q\n", handler.tag(""), handler.tag("db"))
+	}
+	handler.config.TagPrefix = "app"
+	if handler.tag("") != "app" || handler.tag("db") != "app.db" {
+		t.Errorf("%q, %q\n", handler.tag(""), handler.tag("db"))
+	}
+}
+
+func TestFluentAck(t *testing.T) {
+	var b bytes.Buffer
+	writeMsgpackMap(&b, 1)
+	writeMsgpackString(&b, "ack")
+	writeMsgpackString(&b, "chunk")
+	if ack, err := readFluentAck(&b); ack != "chunk" || err != nil {
+		t.Errorf("%q, %v\n", ack, err)
+	}
+	for _, resp := range []string{
+		"\xdd\xff\xff\xff\xff",            // array of 2^32-1 elements
+		"\xdf\xff\xff\xff\xff",            // map of 2^32-1 pairs
+		"\xdb\xff\xff\xff\xff",            // string of 2^32-1 bytes
+		"\x81\xa3ack\xc6\xff\xff\xff\xff", // ack of 2^32-1 bytes of binary
+		"\x82\xa3ack\xa1c\xa1x\x01",       // another key
+		"\x81\xa3ack\x01",                 // ack of an integer
+		"\x91\xa3ack",                     // array
+	} {
+		if ack, err := readFluentAck(strings.NewReader(resp)); err == nil {
+			t.Errorf("%q, %q\n", resp, ack)
+		}
+	}
+	// a long ack is cut at the limit
+	if _, err := readFluentAck(strings.NewReader("\x81\xa3ack\xdb\x00\x01\x00\x00" + strings.Repeat("x", 1<<16))); err == nil {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestFluentEntry(t *testing.T) {
+	logger := newLogger("fluent", NOTSET, nil)
+	r := Record{level: Level(42), format: "%s", args: []interface{}{"m"},
+		context: []interface{}{"level", "x", "message", "y", "user", "u"}}
+	r.genNonRuntime(logger)
+	var b bytes.Buffer
+	writeFluentEntry(&b, &r)
+	br := bufio.NewReader(&b)
+	v, err := readMsgpack(br)
+	a, ok := v.([]interface{})
+	if err != nil || !ok || len(a) != 2 || br.Buffered() != 0 {
+		t.Fatalf("%v %v %v\n", v, err, br.Buffered())
+	}
+	m, ok := a[1].(map[interface{}]interface{})
+	if !ok || len(m) != 3 || m["level"] != "42" || m["message"] != "m" || m["user"] != "u" {
+		t.Errorf("%v\n", a[1])
+	}
+}
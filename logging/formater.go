@@ -17,50 +17,258 @@
 package logging
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // pre-defined formats
 const (
 	BasicFormat = "%s [%6s] %30s - %s\n name,levelname,time,message"
 	RichFormat  = "%s [%6s] %d %30s - %s:%s:%d - %s\n name, levelname, seqid, time, filename, funcname, lineno, message"
+
+	// JournalFormat prefixes records with their syslog severities, which
+	// systemd-journald parses from the standard output and error of
+	// services.
+	JournalFormat = "<{priority}>{name} - {message}"
 )
 
+// segment is a part of a compiled named-placeholder format, which is either
+// literal text or a field padded to a width.
+type segment struct {
+	text    string    // literal text if field is ""
+	field   string    // name of the field
+	fn      fieldFunc // function of the field
+	runtime bool      // the field is a runtime field or not
+	width   int       // minimum width of the field
+	align   byte      // '<', '>', or '^' for left, right, or center alignment
+}
+
+// layout is a parsed record format. A handler replaces its whole layout when
+// the format is changed, so that the format can be changed while records are
+// written.
+type layout struct {
+	format       string      // format given by users
+	recordFormat string      // format of the record
+	recordArgs   []string    // arguments to be used in the recordFormat
+	recordFuncs  []fieldFunc // functions of the recordArgs
+	plan         []segment   // compiled named-placeholder format, if used
+	runtime      bool        // with runtime operation or not
+}
+
 // genLog generates log string from the format setting.
-func (logger *Logger) genLog(level Level, message string) string {
-	fs := make([]interface{}, len(logger.recordArgs))
-	r := new(record)
-	r.message = message
-	r.level = level
-	r.genNonRuntime(logger)
-	if logger.runtime {
+func (layout *layout) genLog(r *Record) string {
+	if layout.runtime {
 		r.genRuntime()
 	}
-	for k, v := range logger.recordArgs {
-		fs[k] = fields[v](logger, r)
+	if layout.plan != nil {
+		var b bytes.Buffer
+		genPlan(&b, layout.plan, r)
+		return b.String()
+	}
+	fs := make([]interface{}, len(layout.recordFuncs))
+	for k, fn := range layout.recordFuncs {
+		fs[k] = fn(r.logger, r)
+	}
+	return fmt.Sprintf(layout.recordFormat, fs...)
+}
+
+// genPlan writes the record in a compiled named-placeholder format.
+func genPlan(b *bytes.Buffer, plan []segment, r *Record) {
+	for _, seg := range plan {
+		if seg.field == "" {
+			b.WriteString(seg.text)
+			continue
+		}
+		v := fmt.Sprint(seg.fn(r.logger, r))
+		pad := seg.width - utf8.RuneCountInString(v)
+		if pad <= 0 {
+			b.WriteString(v)
+			continue
+		}
+		left := 0
+		switch seg.align {
+		case '>':
+			left = pad
+		case '^':
+			left = pad / 2
+		}
+		b.WriteString(strings.Repeat(" ", left))
+		b.WriteString(v)
+		b.WriteString(strings.Repeat(" ", pad-left))
+	}
+}
+
+// basicLayout is the layout of BasicFormat, for handlers created without a
+// format of their own.
+var basicLayout = mustParseFormat(BasicFormat)
+
+// mustParseFormat parses a format which is known to be legal.
+func mustParseFormat(format string) *layout {
+	layout, err := parseFormat(format)
+	if err != nil {
+		panic(err)
 	}
-	return fmt.Sprintf(logger.recordFormat, fs...)
+	return layout
 }
 
-// parseFormat checks the legality of format and parses it to recordFormat and recordArgs
-func (logger *Logger) parseFormat(format string) error {
-	logger.runtime = false
+// parseFormat checks the legality of format and parses it to a layout with
+// recordFormat and recordArgs. A format with a newline has the printf-style
+// syntax, and is checked to have as many verbs as fields. A format without
+// newline has the named-placeholder syntax, and is compiled to the plan. It
+// must have a placeholder, so that a printf-style format missing its fields,
+// e.g. "%s - %s", is still an error.
+func parseFormat(format string) (*layout, error) {
+	if !strings.Contains(format, "\n") {
+		layout, err := parsePlan(format)
+		if err == nil && len(layout.recordArgs) == 0 {
+			return nil, errors.New("logging format error: no fields")
+		}
+		return layout, err
+	}
+	layout := &layout{format: format}
 	fts := strings.Split(format, "\n")
 	if len(fts) != 2 {
-		return errors.New("logging format error")
+		return nil, errors.New("logging format error")
 	}
-	logger.recordFormat = fts[0]
-	logger.recordArgs = strings.Split(fts[1], ",")
-	for k, v := range logger.recordArgs {
+	layout.recordFormat = fts[0]
+	layout.recordArgs = strings.Split(fts[1], ",")
+	layout.recordFuncs = make([]fieldFunc, len(layout.recordArgs))
+	for k, v := range layout.recordArgs {
 		tv := strings.TrimSpace(v)
-		_, ok := fields[tv]
+		fn, runtime, ok := lookupField(tv)
 		if ok == false {
-			return errors.New("logging format error")
+			return nil, errors.New("logging format error")
+		}
+		layout.recordArgs[k] = tv
+		layout.recordFuncs[k] = fn
+		layout.runtime = layout.runtime || runtime
+	}
+	if n := countVerbs(layout.recordFormat); n >= 0 && n != len(layout.recordArgs) {
+		return nil, fmt.Errorf("logging format error: %d verbs for %d fields", n, len(layout.recordArgs))
+	}
+	return layout, nil
+}
+
+// parsePlan parses a named-placeholder format, such as
+//
+//	{time} [{levelname:>6}] {name:-10} - {message}
+//
+// where a field may be followed by a colon and a width, which is aligned to
+// the right by default or by '>', to the left by '<' or '-', and to the
+// center by '^'. Literal braces are written as {{ and }}. The recordFormat is
+// the format itself and the recordArgs are the fields in order.
+func parsePlan(format string) (*layout, error) {
+	layout := &layout{format: format}
+	var plan []segment
+	var args []string
+	var text bytes.Buffer
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c == '}' {
+			if i+1 < len(format) && format[i+1] == '}' {
+				i++
+				text.WriteByte('}')
+				continue
+			}
+			return nil, errors.New("logging format error: unmatched }")
+		}
+		if c != '{' {
+			text.WriteByte(c)
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == '{' {
+			i++
+			text.WriteByte('{')
+			continue
+		}
+		end := strings.IndexByte(format[i:], '}')
+		if end < 0 {
+			return nil, errors.New("logging format error: unmatched {")
+		}
+		seg, err := parseSegment(format[i+1 : i+end])
+		if err != nil {
+			return nil, err
+		}
+		if text.Len() > 0 {
+			plan = append(plan, segment{text: text.String()})
+			text.Reset()
+		}
+		plan = append(plan, seg)
+		args = append(args, seg.field)
+		layout.runtime = layout.runtime || seg.runtime
+		i += end
+	}
+	if text.Len() > 0 {
+		plan = append(plan, segment{text: text.String()})
+	}
+	layout.plan = plan
+	layout.recordFormat = format
+	layout.recordArgs = args
+	layout.recordFuncs = nil
+	return layout, nil
+}
+
+// parseSegment parses a placeholder without braces, e.g. "levelname:>6".
+func parseSegment(s string) (segment, error) {
+	seg := segment{align: '>'}
+	spec := ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		s, spec = s[:i], s[i+1:]
+	}
+	seg.field = strings.TrimSpace(s)
+	fn, runtime, ok := lookupField(seg.field)
+	if !ok {
+		return seg, errors.New("logging format error: unknown field " + seg.field)
+	}
+	seg.fn = fn
+	seg.runtime = runtime
+	if spec == "" {
+		return seg, nil
+	}
+	switch spec[0] {
+	case '<', '-':
+		seg.align = '<'
+		spec = spec[1:]
+	case '>', '^':
+		seg.align = spec[0]
+		spec = spec[1:]
+	}
+	width, err := strconv.Atoi(spec)
+	if err != nil || width < 0 {
+		return seg, errors.New("logging format error: bad width " + spec)
+	}
+	seg.width = width
+	return seg, nil
+}
+
+// countVerbs counts the arguments used by the verbs of a printf-style format.
+// It returns -1 if the format uses explicit argument indexes.
+func countVerbs(format string) int {
+	n := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		for i++; i < len(format); i++ {
+			c := format[i]
+			if c == '[' {
+				return -1
+			}
+			if c == '*' {
+				n++
+				continue
+			}
+			if strings.IndexByte("+-# 0.123456789", c) < 0 {
+				if c != '%' {
+					n++
+				}
+				break
+			}
 		}
-		logger.recordArgs[k] = tv
-		logger.runtime = logger.runtime || runtimeFields[tv]
 	}
-	return nil
+	return n
 }
@@ -0,0 +1,231 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// GELFEncoder is an encoder writing records as GELF 1.1 messages, with the
+// level as a syslog severity, the funcname, filename and lineno fields as
+// _func, _file and line, the logger name as _logger, and the context fields
+// as additional fields prefixed by _. It is used with a GELFWriter for UDP, or
+// with a NetWriter with NullFraming for TCP.
+type GELFEncoder struct {
+	host string
+}
+
+// NewGELFEncoder creates a new GELF encoder, with the host of messages, or
+// the hostname if host is "".
+func NewGELFEncoder(host string) *GELFEncoder {
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	return &GELFEncoder{host: host}
+}
+
+// Runtime reports that the caller of records is needed.
+func (encoder *GELFEncoder) Runtime() bool {
+	return true
+}
+
+// gelfInvalid matches the characters not allowed in names of additional
+// fields.
+var gelfInvalid = regexp.MustCompile(`[^\w.\-]`)
+
+// Encode writes the record as a GELF message.
+func (encoder *GELFEncoder) Encode(b *bytes.Buffer, r *Record) {
+	b.WriteString(`{"version":"1.1","host":`)
+	writeJSONString(b, encoder.host)
+	b.WriteString(`,"short_message":`)
+	writeJSONString(b, r.Message())
+	nsec := r.Time().UnixNano()
+	fmt.Fprintf(b, `,"timestamp":%d.%06d,"level":%d,"_logger":`, nsec/1e9, nsec%1e9/1e3, SyslogSeverity(r.level))
+	writeJSONString(b, r.Name())
+	if r.Pathname() != errString {
+		b.WriteString(`,"_func":`)
+		writeJSONString(b, r.Funcname())
+		b.WriteString(`,"_file":`)
+		writeJSONString(b, r.Filename())
+		fmt.Fprintf(b, `,"line":%d`, r.Lineno())
+	}
+	for i := 0; i+1 < len(r.context); i += 2 {
+		key := "_" + gelfInvalid.ReplaceAllString(fmt.Sprint(r.context[i]), "_")
+		if key == "_id" {
+			key = "__id"
+		}
+		b.WriteByte(',')
+		writeJSONString(b, key)
+		b.WriteByte(':')
+		writeJSONValue(b, r.context[i+1])
+	}
+	b.WriteByte('}')
+}
+
+// GELFCompression is the compression of GELF messages over UDP.
+type GELFCompression int
+
+// Compressions of GELF messages
+const (
+	GELFNone GELFCompression = iota
+	GELFGzip
+	GELFZlib
+)
+
+// The limits of GELF chunks
+const (
+	DefaultGELFChunkSize = 1420 // default size of chunks, which fits in WAN packets
+	gelfMaxChunks        = 128  // maximum number of chunks of a message
+	gelfChunkHeader      = 12   // size of the header of chunks
+)
+
+// GELFWriter is a writer of GELF messages over UDP, which takes each write as
+// a message, compresses it if configured, and splits it into chunks if it is
+// larger than the chunk size. Messages over 128 chunks are dropped.
+type GELFWriter struct {
+	lock        sync.Mutex
+	conn        net.Conn
+	compression GELFCompression
+	chunkSize   int
+}
+
+// NewGELFWriter creates a new writer of GELF messages to addr over UDP, with
+// chunks of at most chunkSize bytes, or DefaultGELFChunkSize if it is 0.
+func NewGELFWriter(addr string, compression GELFCompression, chunkSize int) (*GELFWriter, error) {
+	if chunkSize == 0 {
+		chunkSize = DefaultGELFChunkSize
+	}
+	if chunkSize <= gelfChunkHeader {
+		return nil, fmt.Errorf("logging gelf error: chunk size %d", chunkSize)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &GELFWriter{conn: conn, compression: compression, chunkSize: chunkSize}, nil
+}
+
+// Write writes p as one message.
+func (w *GELFWriter) Write(p []byte) (int, error) {
+	if err := w.WriteRecord(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteRecord writes a message, in chunks if needed. It fails if the writer
+// is closed.
+func (w *GELFWriter) WriteRecord(p []byte) error {
+	p = bytes.TrimSuffix(p, []byte{'\n'})
+	var b bytes.Buffer
+	switch w.compression {
+	case GELFGzip:
+		zw := gzip.NewWriter(&b)
+		zw.Write(p)
+		zw.Close()
+		p = b.Bytes()
+	case GELFZlib:
+		zw := zlib.NewWriter(&b)
+		zw.Write(p)
+		zw.Close()
+		p = b.Bytes()
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.conn == nil {
+		return errors.New("logging gelf error: closed")
+	}
+	if len(p) <= w.chunkSize {
+		_, err := w.conn.Write(p)
+		return err
+	}
+	size := w.chunkSize - gelfChunkHeader
+	count := (len(p) + size - 1) / size
+	if count > gelfMaxChunks {
+		return fmt.Errorf("logging gelf error: %d chunks", count)
+	}
+	chunk := make([]byte, w.chunkSize)
+	chunk[0], chunk[1] = 0x1e, 0x0f
+	if _, err := rand.Read(chunk[2:10]); err != nil {
+		return err
+	}
+	chunk[11] = byte(count)
+	for i := 0; i < count; i++ {
+		chunk[10] = byte(i)
+		n := copy(chunk[gelfChunkHeader:], p[i*size:])
+		if _, err := w.conn.Write(chunk[:gelfChunkHeader+n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reopen does nothing, because UDP is connectionless.
+func (w *GELFWriter) Reopen() error {
+	return nil
+}
+
+// moved reports false, because there is no file to watch.
+func (w *GELFWriter) moved() bool {
+	return false
+}
+
+// Close closes the socket.
+func (w *GELFWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.conn == nil {
+		return errors.New("logging gelf error: closed")
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// NewGELFHandler creates a new handler writing GELF messages to addr over
+// "udp", with the compression, or over "tcp", delimited by null bytes, where
+// the connection is reconnected by a NetWriter.
+func NewGELFHandler(level Level, network string, addr string, compression GELFCompression, sync bool) (*WriterHandler, error) {
+	var out fileWriter
+	switch network {
+	case "udp":
+		w, err := NewGELFWriter(addr, compression, 0)
+		if err != nil {
+			return nil, err
+		}
+		out = w
+	case "tcp":
+		out = NewNetWriter("tcp", addr, NullFraming, DefaultNetTimeout, DefaultNetBuffer)
+	default:
+		return nil, errors.New("logging gelf error: network " + network)
+	}
+	handler, err := newFileHandler(level, BasicFormat, DefaultTimeFormat, out, "", sync)
+	if err != nil {
+		return nil, err
+	}
+	handler.SetEncoder(NewGELFEncoder(""))
+	return handler, nil
+}
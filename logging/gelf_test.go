@@ -0,0 +1,134 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGELF(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer udp.Close()
+	udp.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	logger, _ := WriterLogger("gelf", DEBUG, BasicFormat, DefaultTimeFormat, ioutil.Discard, true)
+	defer logger.Destroy()
+	handler, err := NewGELFHandler(INFO, "udp", udp.LocalAddr().String(), GELFNone, true)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	logger.AddHandler(handler)
+	logger.With("id", 1, "user name", "alice").Warning("warned")
+	buf := make([]byte, 65536)
+	n, _, _ := udp.ReadFrom(buf)
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf[:n], &m); err != nil {
+		t.Fatalf("%v, %q\n", err, buf[:n])
+	}
+	if m["version"] != "1.1" || m["short_message"] != "warned" || m["level"] != 4.0 || m["_logger"] != "gelf" ||
+		m["_func"] != "TestGELF" || m["_file"] != "gelf_test.go" || m["line"] == nil || m["__id"] != 1.0 || m["_user_name"] != "alice" {
+		t.Errorf("%q\n", buf[:n])
+	}
+	logger.RemoveHandler(handler)
+	handler.Close()
+
+	w, _ := NewGELFWriter(udp.LocalAddr().String(), GELFGzip, 100)
+	var text bytes.Buffer
+	for i := 0; text.Len() < 2000; i++ {
+		fmt.Fprint(&text, i*i*7919%10007, " ")
+	}
+	large := `{"short_message":"` + text.String() + `"}`
+	w.Write([]byte(large + "\n"))
+	w.Close()
+	if n, err := w.Write([]byte("closed\n")); n != 0 || err == nil {
+		t.Errorf("%v, %v\n", n, err)
+	}
+	var chunks [][]byte
+	for count := 1; len(chunks) < count; {
+		n, _, err := udp.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("%v\n", err)
+		}
+		if n <= 12 || buf[0] != 0x1e || buf[1] != 0x0f {
+			t.Fatalf("%q\n", buf[:n])
+		}
+		count = int(buf[11])
+		chunks = append(chunks, append([]byte(nil), buf[:n]...))
+	}
+	if len(chunks) < 2 {
+		t.Errorf("%v\n", len(chunks))
+	}
+	var compressed []byte
+	for i, chunk := range chunks {
+		if int(chunk[10]) != i || !bytes.Equal(chunk[2:10], chunks[0][2:10]) {
+			t.Errorf("%v\n", chunk[:12])
+		}
+		compressed = append(compressed, chunk[12:]...)
+	}
+	r, _ := gzip.NewReader(bytes.NewReader(compressed))
+	if data, _ := ioutil.ReadAll(r); string(data) != large {
+		t.Errorf("%q\n", data)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer ln.Close()
+	handler, _ = NewGELFHandler(INFO, "tcp", ln.Addr().String(), GELFNone, false)
+	logger.AddHandler(handler)
+	logger.Info("first")
+	logger.Info("second")
+	logger.Flush()
+	conn, _ := ln.Accept()
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	br := bufio.NewReader(conn)
+	for _, expected := range []string{"first", "second"} {
+		msg, _ := br.ReadBytes(0)
+		json.Unmarshal(bytes.TrimSuffix(msg, []byte{0}), &m)
+		if m["short_message"] != expected {
+			t.Errorf("%q\n", msg)
+		}
+	}
+}
+
+func TestGELFEncoderNoCaller(t *testing.T) {
+	logger := newLogger("gelf", NOTSET, nil)
+	r := Record{level: WARNING, args: []interface{}{"no caller"}}
+	r.genNonRuntime(logger)
+	var b bytes.Buffer
+	NewGELFEncoder("host").Encode(&b, &r)
+	var m map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &m); err != nil {
+		t.Fatalf("%v, %q\n", err, b.Bytes())
+	}
+	if m["short_message"] != "no caller" || m["_file"] != nil || m["_func"] != nil || m["line"] != nil {
+		t.Errorf("%q\n", b.Bytes())
+	}
+}
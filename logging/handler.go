@@ -0,0 +1,334 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Handler writes the records of loggers to an output. A logger passes every
+// record that passes its level to all of its handlers, and handlers can
+// apply their own level, format and way of writing.
+type Handler interface {
+	// Handle writes the record. The record must not be used after Handle
+	// returns, so handlers that write in other goroutines copy it.
+	Handle(r *Record)
+	// Runtime reports whether the handler uses the runtime fields of
+	// records, which are only collected if some handler needs them.
+	Runtime() bool
+	// Flush writes the buffered records.
+	Flush()
+	// Close flushes the handler and releases its resources.
+	Close()
+}
+
+// RecordWriter is a writer which takes records one by one, e.g. to frame
+// them. Handlers write each record to it by a WriteRecord call, instead of
+// a batch of records by a Write call.
+type RecordWriter interface {
+	io.Writer
+	WriteRecord(p []byte) error
+}
+
+// WriterHandler is a handler that writes records to an io.Writer in a record
+// format, either in the calling goroutine (sync) or in a watcher goroutine
+// (async).
+type WriterHandler struct {
+	// These variables can be configured by users.
+	level      Level        // record level higher than this will be printed
+	layout     atomic.Value // *layout of the record format
+	out        io.Writer    // writer
+	sync       bool         // use sync or async way to record logs
+	timeFormat string       // format for time
+	filterList              // filters to check records
+	encoder    Encoder      // encoder used instead of the format if not nil
+
+	// Internally used variables, which don't have get and set functions.
+	wlock  sync.Mutex // writer lock
+	queue  *queue     // queue used in async logging
+	flush  chan bool  // flush signal for the watcher to write
+	finish chan bool  // finish flush signal for the flush function to return
+	quit   chan bool  // quit signal for the watcher to quit
+	fd     fileWriter // file writer, used to close the file on close
+	file   string     // name of the file opened by NewFileHandler
+	done   chan bool  // closed on close to stop the file watching and blocked records
+	close  sync.Once  // make Close run only once
+	closed int32      // set when closed, to ignore records and flushes
+
+	// The customized configurations.
+	bufferSize   int
+	timeInterval time.Duration
+}
+
+// NewWriterHandler creates a new handler with a writer.
+func NewWriterHandler(level Level, format string, timeFormat string, out io.Writer, sync bool) (*WriterHandler, error) {
+	return NewCustomizedHandler(level, format, timeFormat, out, sync, DefaultRequestSize, DefaultBufferSize, DefaultTimeInterval)
+}
+
+// NewFileHandler creates a new handler with file output.
+func NewFileHandler(level Level, format string, timeFormat string, file string, sync bool) (*WriterHandler, error) {
+	out, err := newAppendFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return newFileHandler(level, format, timeFormat, out, file, sync)
+}
+
+// newFileHandler creates a new handler writing to the file writer out, which
+// is closed if the handler cannot be created.
+func newFileHandler(level Level, format string, timeFormat string, out fileWriter, file string, sync bool) (*WriterHandler, error) {
+	handler, err := NewWriterHandler(level, format, timeFormat, out, sync)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	handler.fd = out
+	handler.file = file
+	return handler, nil
+}
+
+// NewCustomizedHandler creates a new handler with all configurations
+// customized (in addition to NewWriterHandler).
+func NewCustomizedHandler(level Level, format string, timeFormat string, out io.Writer, sync bool, requestSize int, bufferSize int, timeInterval time.Duration) (*WriterHandler, error) {
+	layout, err := parseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	return newWriterHandler(level, layout, timeFormat, out, sync, requestSize, bufferSize, timeInterval), nil
+}
+
+// newWriterHandler creates a new handler with the layout of a parsed record
+// format.
+func newWriterHandler(level Level, layout *layout, timeFormat string, out io.Writer, sync bool, requestSize int, bufferSize int, timeInterval time.Duration) *WriterHandler {
+	handler := new(WriterHandler)
+
+	// assign values to handler
+	handler.level = level
+	handler.layout.Store(layout)
+	handler.out = out
+	handler.sync = sync
+	handler.queue = newQueue(requestSize)
+	handler.flush = make(chan bool)
+	handler.finish = make(chan bool)
+	handler.quit = make(chan bool)
+	handler.done = make(chan bool)
+	handler.fd = nil
+	handler.timeFormat = timeFormat
+	handler.bufferSize = bufferSize
+	handler.timeInterval = timeInterval
+
+	// start watcher to write logs if it is async
+	if !handler.sync {
+		go handler.watcher()
+	}
+
+	return handler
+}
+
+// Handle writes the record if its level is not lower than the level of the
+// handler and it passes all the filters of the handler.
+func (handler *WriterHandler) Handle(r *Record) {
+	if r.level < handler.Level() || !handler.passes(r) || handler.Closed() {
+		return
+	}
+	if handler.sync {
+		var buf bytes.Buffer
+		rec := *r
+		handler.flushReq(&buf, &rec)
+		handler.flushMsg(buf.Bytes())
+	} else {
+		handler.queue.push(r, handler.done)
+	}
+}
+
+// Runtime reports whether the record format, or the encoder if set, or a
+// filter has runtime fields.
+func (handler *WriterHandler) Runtime() bool {
+	if handler.encoder != nil {
+		return handler.encoder.Runtime() || handler.filtersRuntime()
+	}
+	return handler.getLayout().runtime || handler.filtersRuntime()
+}
+
+// Flush the writer. It returns without flushing if the handler is closed,
+// even by another goroutine while it waits.
+func (handler *WriterHandler) Flush() {
+	if !handler.sync {
+		select {
+		case handler.flush <- true:
+			// wait for the flush finish
+			<-handler.finish
+		case <-handler.done:
+		}
+	}
+}
+
+// Close sends quit signal to watcher and releases all the resources. Calls
+// after the first one do nothing.
+func (handler *WriterHandler) Close() {
+	handler.close.Do(func() {
+		atomic.StoreInt32(&handler.closed, 1)
+		close(handler.done)
+		if !handler.sync {
+			// quit watcher
+			handler.quit <- true
+			// wait for watcher quit
+			<-handler.quit
+		}
+		// clean up
+		if handler.fd != nil {
+			handler.fd.Close()
+		}
+	})
+}
+
+// Getter functions
+
+func (handler *WriterHandler) Level() Level {
+	return Level(atomic.LoadInt32((*int32)(&handler.level)))
+}
+
+func (handler *WriterHandler) Format() string {
+	return handler.getLayout().format
+}
+
+func (handler *WriterHandler) TimeFormat() string {
+	return handler.timeFormat
+}
+
+func (handler *WriterHandler) RecordFormat() string {
+	return handler.getLayout().recordFormat
+}
+
+func (handler *WriterHandler) RecordArgs() []string {
+	return handler.getLayout().recordArgs
+}
+
+func (handler *WriterHandler) Writer() io.Writer {
+	handler.wlock.Lock()
+	defer handler.wlock.Unlock()
+	return handler.out
+}
+
+// File returns the name of the file opened by NewFileHandler, or "" if the
+// handler is created with a writer.
+func (handler *WriterHandler) File() string {
+	return handler.file
+}
+
+func (handler *WriterHandler) Sync() bool {
+	return handler.sync
+}
+
+// Closed reports whether the handler is closed, after which records are
+// ignored.
+func (handler *WriterHandler) Closed() bool {
+	return atomic.LoadInt32(&handler.closed) != 0
+}
+
+// QueueDepth returns the number of records waiting in the queue of an async
+// handler.
+func (handler *WriterHandler) QueueDepth() int {
+	return handler.queue.len()
+}
+
+// QueueSize returns the capacity of the queue of an async handler.
+func (handler *WriterHandler) QueueSize() int {
+	return handler.queue.size
+}
+
+// QueueBytes returns the estimated bytes of the records waiting in the queue
+// of an async handler.
+func (handler *WriterHandler) QueueBytes() int {
+	handler.queue.lock.Lock()
+	defer handler.queue.lock.Unlock()
+	return handler.queue.bytes
+}
+
+// Dropped returns the number of records dropped by the overflow policy of an
+// async handler.
+func (handler *WriterHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&handler.queue.dropped)
+}
+
+func (handler *WriterHandler) Encoder() Encoder {
+	return handler.encoder
+}
+
+// Setter functions
+
+func (handler *WriterHandler) SetLevel(level Level) {
+	atomic.StoreInt32((*int32)(&handler.level), int32(level))
+}
+
+// SetFormat parses and sets the record format. The records written after it
+// returns use the new format, including the ones already queued.
+func (handler *WriterHandler) SetFormat(format string) error {
+	layout, err := parseFormat(format)
+	if err != nil {
+		return err
+	}
+	handler.layout.Store(layout)
+	return nil
+}
+
+func (handler *WriterHandler) SetWriter(out ...io.Writer) {
+	handler.wlock.Lock()
+	defer handler.wlock.Unlock()
+	handler.out = io.MultiWriter(out...)
+}
+
+// SetEncoder sets the encoder used to write records instead of the record
+// format. A nil encoder restores the record format.
+func (handler *WriterHandler) SetEncoder(encoder Encoder) {
+	handler.encoder = encoder
+}
+
+// SetOverflow sets the policy of an async handler when its queue is full,
+// with the timeout of OverflowBlockTimeout.
+func (handler *WriterHandler) SetOverflow(overflow Overflow, timeout time.Duration) {
+	handler.queue.lock.Lock()
+	defer handler.queue.lock.Unlock()
+	handler.queue.overflow = overflow
+	handler.queue.timeout = timeout
+}
+
+// SetQueueBytes bounds the queue of an async handler by the estimated bytes
+// of its records instead of their number, if maxBytes is positive. The size
+// of a record is estimated from its message, which is then generated by the
+// logging goroutine rather than the watcher.
+func (handler *WriterHandler) SetQueueBytes(maxBytes int64) {
+	atomic.StoreInt64(&handler.queue.maxBytes, maxBytes)
+}
+
+// SetDropReport sets whether an async handler writes a WARNING record of the
+// number of dropped records, from the logger named "logging", once its queue
+// has space again.
+func (handler *WriterHandler) SetDropReport(report bool) {
+	handler.queue.lock.Lock()
+	defer handler.queue.lock.Unlock()
+	handler.queue.report = report
+}
+
+// getLayout returns the current layout of the record format.
+func (handler *WriterHandler) getLayout() *layout {
+	return handler.layout.Load().(*layout)
+}
@@ -0,0 +1,314 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPProtocol is the protocol of shipping records by HTTP.
+type HTTPProtocol int
+
+// Protocols of shipping records by HTTP
+const (
+	LokiProtocol    HTTPProtocol = iota // Loki push API in JSON
+	ElasticProtocol                     // Elasticsearch _bulk API in NDJSON
+)
+
+// HTTPConfig configures an HTTPHandler.
+type HTTPConfig struct {
+	URL          string            // URL of the push or _bulk API
+	Protocol     HTTPProtocol      // protocol of the API
+	Index        string            // index of Elasticsearch
+	Labels       map[string]string // labels of Loki in addition to logger and level, which can't be overridden
+	Encoder      Encoder           // encoder of Loki lines or Elasticsearch documents
+	Gzip         bool              // compress request bodies by gzip
+	Client       *http.Client      // client, or a client with Timeout if nil
+	Timeout      time.Duration     // timeout of a request of the default client, DefaultNetTimeout if 0
+	BufferSize   int               // maximum records in a batch, DefaultBufferSize if 0
+	TimeInterval time.Duration     // maximum milliseconds to wait for a batch, DefaultTimeInterval if 0
+	MaxRetries   int               // maximum retries of a batch on 5xx and 429, 5 if 0
+	Errors       chan<- error      // channel receiving errors, which are dropped if it is full or nil
+}
+
+// HTTPHandler is a handler that ships records in batches to Loki or
+// Elasticsearch by HTTP. Like the watcher of an async WriterHandler, it
+// sends a batch when it has BufferSize records or after TimeInterval
+// milliseconds. A batch is retried with exponential backoff on 5xx and 429
+// responses and on network errors, and dropped after MaxRetries retries. The
+// records rejected by Elasticsearch in a successful _bulk response are
+// reported to Errors, and not retried. Records wait in a queue handling the
+// overflow like the one of an async WriterHandler, see SetOverflow.
+type HTTPHandler struct {
+	level      Level // record level higher than this will be shipped
+	filterList       // filters to check records
+	config     HTTPConfig
+	client     *http.Client
+
+	*batcher
+}
+
+// NewHTTPHandler creates a new handler shipping records by HTTP. The encoder
+// is a JSON encoder of the time, name, levelname, message and ctx fields for
+// Elasticsearch, and a logfmt encoder of the message and ctx fields for Loki,
+// if it is nil.
+func NewHTTPHandler(level Level, config HTTPConfig) (*HTTPHandler, error) {
+	if config.URL == "" {
+		return nil, errors.New("logging http error: no URL")
+	}
+	if config.Protocol == ElasticProtocol && config.Index == "" {
+		return nil, errors.New("logging http error: no index")
+	}
+	if config.Encoder == nil {
+		var err error
+		if config.Protocol == ElasticProtocol {
+			var encoder *JSONEncoder
+			encoder, err = NewJSONEncoder("time", "name", "levelname", "message", "ctx")
+			if err == nil {
+				encoder.SetKey("time", "@timestamp")
+				config.Encoder = encoder
+			}
+		} else {
+			config.Encoder, err = NewLogfmtEncoder("message", "ctx")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = DefaultBufferSize
+	}
+	if config.TimeInterval <= 0 {
+		config.TimeInterval = DefaultTimeInterval
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = 5
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultNetTimeout
+	}
+	handler := &HTTPHandler{level: level, config: config, client: config.Client}
+	if handler.client == nil {
+		handler.client = &http.Client{Timeout: config.Timeout}
+	}
+	handler.batcher = newBatcher(config.BufferSize, config.TimeInterval, handler.send)
+	return handler, nil
+}
+
+// Handle queues the record if its level is not lower than the level of the
+// handler and it passes all the filters of the handler.
+func (handler *HTTPHandler) Handle(r *Record) {
+	if r.level < handler.Level() || !handler.passes(r) {
+		return
+	}
+	handler.push(r)
+}
+
+// send encodes and posts a batch, retrying it with exponential backoff.
+func (handler *HTTPHandler) send(batch []Record) {
+	var body bytes.Buffer
+	var w io.Writer = &body
+	var zw *gzip.Writer
+	if handler.config.Gzip {
+		zw = gzip.NewWriter(&body)
+		w = zw
+	}
+	if handler.config.Protocol == ElasticProtocol {
+		handler.encodeElastic(w, batch)
+	} else {
+		handler.encodeLoki(w, batch)
+	}
+	if zw != nil {
+		zw.Close()
+	}
+	var resp []byte
+	err := retryBackoff(handler.config.MaxRetries, handler.done, func() (retry bool, err error) {
+		resp, retry, err = handler.post(body.Bytes())
+		return retry, err
+	})
+	if err != nil {
+		reportError(handler.config.Errors, fmt.Errorf("logging http error: %d records dropped: %v", len(batch), err))
+		return
+	}
+	if handler.config.Protocol == ElasticProtocol {
+		if err := bulkErrors(resp, len(batch)); err != nil {
+			reportError(handler.config.Errors, err)
+		}
+	}
+}
+
+// post posts a body, and returns the response body of a success, or whether
+// it should be retried on failure.
+func (handler *HTTPHandler) post(body []byte) ([]byte, bool, error) {
+	req, err := http.NewRequest("POST", handler.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	if handler.config.Protocol == ElasticProtocol {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if handler.config.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := handler.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		data, err := ioutil.ReadAll(resp.Body)
+		return data, err != nil, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	retry := resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests
+	return nil, retry, errors.New(resp.Status)
+}
+
+// bulkErrors returns an error of the items rejected in a response of the
+// _bulk API to a batch of n records, which has the status 200 even if some
+// items are rejected.
+func bulkErrors(data []byte, n int) error {
+	var resp struct {
+		Errors bool
+		Items  []map[string]struct {
+			Status int
+			Error  struct {
+				Type   string
+				Reason string
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("logging http error: invalid _bulk response: %v", err)
+	}
+	if !resp.Errors {
+		return nil
+	}
+	rejected := 0
+	var reason string
+	for _, item := range resp.Items {
+		for _, result := range item {
+			if result.Status/100 == 2 {
+				continue
+			}
+			if rejected++; reason == "" {
+				reason = result.Error.Type + ": " + result.Error.Reason
+			}
+		}
+	}
+	return fmt.Errorf("logging http error: %d of %d records rejected: %s", rejected, n, reason)
+}
+
+// encodeLoki writes a batch as a push request of Loki, with a stream for
+// each pair of logger name and level.
+func (handler *HTTPHandler) encodeLoki(w io.Writer, batch []Record) {
+	type stream struct {
+		name  string
+		level Level
+	}
+	var streams []stream
+	values := make(map[stream]*bytes.Buffer)
+	for i := range batch {
+		r := &batch[i]
+		r.timeFormat = time.RFC3339Nano
+		s := stream{r.Name(), r.level}
+		b, ok := values[s]
+		if !ok {
+			b = new(bytes.Buffer)
+			values[s] = b
+			streams = append(streams, s)
+		} else {
+			b.WriteByte(',')
+		}
+		var line bytes.Buffer
+		handler.config.Encoder.Encode(&line, r)
+		b.WriteString(`["`)
+		b.WriteString(strconv.FormatInt(r.Time().UnixNano(), 10))
+		b.WriteString(`",`)
+		writeJSONString(b, line.String())
+		b.WriteByte(']')
+	}
+	var b bytes.Buffer
+	b.WriteString(`{"streams":[`)
+	for i, s := range streams {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`{"stream":{"logger":`)
+		writeJSONString(&b, s.name)
+		b.WriteString(`,"level":`)
+		writeJSONString(&b, s.level.String())
+		for k, v := range handler.config.Labels {
+			if k == "logger" || k == "level" {
+				continue
+			}
+			b.WriteByte(',')
+			writeJSONString(&b, k)
+			b.WriteByte(':')
+			writeJSONString(&b, v)
+		}
+		b.WriteString(`},"values":[`)
+		b.Write(values[s].Bytes())
+		b.WriteString(`]}`)
+	}
+	b.WriteString(`]}`)
+	w.Write(b.Bytes())
+}
+
+// encodeElastic writes a batch as a _bulk request of Elasticsearch.
+func (handler *HTTPHandler) encodeElastic(w io.Writer, batch []Record) {
+	var b bytes.Buffer
+	for i := range batch {
+		r := &batch[i]
+		r.timeFormat = time.RFC3339Nano
+		b.WriteString(`{"index":{"_index":`)
+		writeJSONString(&b, handler.config.Index)
+		b.WriteString("}}\n")
+		handler.config.Encoder.Encode(&b, r)
+		b.WriteByte('\n')
+	}
+	w.Write(b.Bytes())
+}
+
+// Runtime reports whether the encoder or a filter has runtime fields.
+func (handler *HTTPHandler) Runtime() bool {
+	return handler.config.Encoder.Runtime() || handler.filtersRuntime()
+}
+
+// Getter functions
+
+func (handler *HTTPHandler) Level() Level {
+	return Level(atomic.LoadInt32((*int32)(&handler.level)))
+}
+
+// Setter functions
+
+func (handler *HTTPHandler) SetLevel(level Level) {
+	atomic.StoreInt32((*int32)(&handler.level), int32(level))
+}
@@ -0,0 +1,266 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	var lock sync.Mutex
+	var bodies []string
+	var response string
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		r := req.Body
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			r, _ = gzip.NewReader(req.Body)
+		}
+		data, _ := ioutil.ReadAll(r)
+		bodies = append(bodies, string(data))
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	logger, _ := WriterLogger("http", DEBUG, BasicFormat, DefaultTimeFormat, ioutil.Discard, true)
+	defer logger.Destroy()
+	handler, err := NewHTTPHandler(INFO, HTTPConfig{URL: server.URL, Gzip: true, BufferSize: 2,
+		Labels: map[string]string{"logger": "other", "level": "other", "app": "test"}})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	logger.AddHandler(handler)
+	logger.Debug("dropped")
+	logger.With("user", "alice").Info("first")
+	logger.Error("second")
+	logger.Info("third")
+	logger.Flush()
+	if len(bodies) != 2 {
+		t.Fatalf("%q\n", bodies)
+	}
+	var push struct {
+		Streams []struct {
+			Stream map[string]string
+			Values [][2]string
+		}
+	}
+	json.Unmarshal([]byte(bodies[0]), &push)
+	// the logger and level labels are not overridden by the extra labels
+	if len(push.Streams) != 2 || strings.Contains(bodies[0], "other") || push.Streams[0].Stream["app"] != "test" ||
+		push.Streams[0].Stream["level"] != "INFO" || push.Streams[0].Stream["logger"] != "http" ||
+		push.Streams[0].Values[0][1] != "message=first user=alice" || push.Streams[1].Values[0][1] != "message=second" {
+		t.Errorf("%q\n", bodies[0])
+	}
+	logger.RemoveHandler(handler)
+	handler.Close()
+
+	bodies = nil
+	response = `{"errors":false,"items":[{"index":{"status":201}}]}`
+	errs := make(chan error, 1)
+	handler, _ = NewHTTPHandler(INFO, HTTPConfig{URL: server.URL, Protocol: ElasticProtocol, Index: "logs", Errors: errs})
+	logger.AddHandler(handler)
+	logger.Warning("warned")
+	logger.Flush()
+	lines := strings.Split(strings.Join(bodies, ""), "\n")
+	if len(lines) != 3 || lines[0] != `{"index":{"_index":"logs"}}` ||
+		!strings.HasPrefix(lines[1], `{"@timestamp":"`) || !strings.HasSuffix(lines[1], `","name":"http","levelname":"WARNING","message":"warned","ctx":{}}`) {
+		t.Errorf("%q\n", lines)
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("%v\n", err)
+	default:
+	}
+
+	// items rejected in a successful response are reported
+	lock.Lock()
+	response = `{"errors":true,"items":[{"index":{"status":201}},` +
+		`{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}]}`
+	lock.Unlock()
+	logger.Warning("accepted")
+	logger.Warning("rejected")
+	logger.Flush()
+	select {
+	case err := <-errs:
+		if err.Error() != "logging http error: 1 of 2 records rejected: mapper_parsing_exception: failed to parse" {
+			t.Errorf("%v\n", err)
+		}
+	default:
+		t.Errorf("no error\n")
+	}
+}
+
+func TestBatcherClose(t *testing.T) {
+	block := make(chan bool)
+	b := newBatcher(1, DefaultTimeInterval, func(batch []Record) { <-block })
+	// the first record is being sent, and the others fill the queue
+	var r Record
+	for i := 0; i < DefaultRequestSize+1; i++ {
+		b.push(&r)
+	}
+	pushed := make(chan bool)
+	go func() {
+		b.push(&r)
+		close(pushed)
+	}()
+	// let the push block, though it returns whichever runs first
+	for i := 0; i < 100; i++ {
+		runtime.Gosched()
+	}
+	closed := make(chan bool)
+	go func() {
+		b.Close()
+		close(closed)
+	}()
+	select {
+	case <-pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("push blocked by a closed batcher\n")
+	}
+	close(block)
+	<-closed
+	b.push(&r)
+	b.Flush()
+}
+
+func TestRetryBackoff(t *testing.T) {
+	failed := errors.New("failed")
+	for _, c := range []struct {
+		retry    bool
+		failures int
+		calls    int
+		err      error
+	}{
+		{true, 0, 1, nil},
+		{true, 1, 2, nil},
+		{false, 1, 1, failed},
+		{true, 5, 2, failed},
+	} {
+		calls := 0
+		err := retryBackoff(1, nil, func() (bool, error) {
+			if calls++; calls <= c.failures {
+				return c.retry, failed
+			}
+			return false, nil
+		})
+		if calls != c.calls || err != c.err {
+			t.Errorf("%v, %v, %v\n", c, calls, err)
+		}
+	}
+	// no retry once done is closed
+	done := make(chan bool)
+	close(done)
+	calls := 0
+	err := retryBackoff(5, done, func() (bool, error) {
+		calls++
+		return true, failed
+	})
+	if calls != 1 || err != failed {
+		t.Errorf("%v, %v\n", calls, err)
+	}
+}
+
+func TestHTTPHandlerHung(t *testing.T) {
+	hung := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-hung
+	}))
+	defer server.Close()
+	defer close(hung)
+	handler, _ := NewHTTPHandler(INFO, HTTPConfig{URL: server.URL, Timeout: 50 * time.Millisecond, MaxRetries: 100})
+	logger, _ := HandlerLogger("hung", INFO, handler)
+	logger.Info("record")
+	closed := make(chan bool)
+	go func() {
+		logger.Destroy()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%v\n", "close blocked by a hung server")
+	}
+}
+
+func TestBatcherOverflow(t *testing.T) {
+	release := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	handler, _ := NewHTTPHandler(INFO, HTTPConfig{URL: server.URL, BufferSize: 1})
+	handler.SetOverflow(OverflowDropNewest, 0)
+	handler.SetQueueBytes(int64(4 * (recordOverhead + len("record"))))
+	logger, _ := HandlerLogger("overflow", INFO, handler)
+	// the first record is being sent, and the others fill the queue or are
+	// dropped, rather than blocking
+	for i := 0; i < 20; i++ {
+		logger.Info("record")
+	}
+	if handler.QueueDepth() != 4 || handler.Dropped() < 15 {
+		t.Errorf("%v, %v\n", handler.QueueDepth(), handler.Dropped())
+	}
+	close(release)
+	logger.Destroy()
+
+	block := make(chan bool)
+	b := newBatcher(1, DefaultTimeInterval, func(batch []Record) { <-block })
+	b.SetOverflow(OverflowDropOldest, 0)
+	var r Record
+	for i := 0; i < DefaultRequestSize+10; i++ {
+		b.push(&r)
+	}
+	if b.QueueDepth() != DefaultRequestSize || b.Dropped() < 9 {
+		t.Errorf("%v, %v\n", b.QueueDepth(), b.Dropped())
+	}
+	close(block)
+	b.Close()
+}
+
+func TestLokiLevel(t *testing.T) {
+	handler, err := NewHTTPHandler(NOTSET, HTTPConfig{URL: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer handler.Close()
+	r := Record{level: Level(42), args: []interface{}{"m"}}
+	r.genNonRuntime(newLogger("loki", NOTSET, nil))
+	var b bytes.Buffer
+	handler.encodeLoki(&b, []Record{r})
+	// a level without a name is labelled by its number
+	if !strings.Contains(b.String(), `"level":"42"`) {
+		t.Errorf("%s\n", b.String())
+	}
+}
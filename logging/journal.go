@@ -0,0 +1,197 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The native socket of systemd-journald
+const journalSocket = "/run/systemd/journal/socket"
+
+// JournalHandler is a handler that writes records to systemd-journald by its
+// native protocol, with the fields MESSAGE, PRIORITY, SYSLOG_IDENTIFIER,
+// CODE_FILE, CODE_LINE and CODE_FUNC, and the context fields in upper case,
+// prefixed by CTX_ if they have the names of those fields. Entries too large
+// for a datagram are passed in a memfd on linux.
+type JournalHandler struct {
+	level      Level        // record level higher than this will be written
+	filterList              // filters to check records
+	identifier string       // SYSLOG_IDENTIFIER, or the logger name if ""
+	errors     chan<- error // channel receiving errors, which are dropped if it is full or nil
+
+	lock   sync.Mutex
+	conn   *net.UnixConn
+	closed int32 // set when closed, to ignore records
+}
+
+// journalFields are the fields written by JournalHandler, which context
+// fields are not allowed to overwrite.
+var journalFields = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+}
+
+// NewJournalHandler creates a new handler writing to systemd-journald. The
+// identifier is the logger name if it is "", or the program name if both
+// are "".
+func NewJournalHandler(level Level, identifier string) (*JournalHandler, error) {
+	return newJournalHandler(level, identifier, journalSocket)
+}
+
+// newJournalHandler creates a new journal handler writing to socket.
+func newJournalHandler(level Level, identifier string, socket string) (*JournalHandler, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &JournalHandler{level: level, identifier: identifier, conn: conn}, nil
+}
+
+// Handle writes the record if its level is not lower than the level of the
+// handler and it passes all the filters of the handler.
+func (handler *JournalHandler) Handle(r *Record) {
+	if r.level < handler.Level() || !handler.passes(r) || atomic.LoadInt32(&handler.closed) != 0 {
+		return
+	}
+	var b bytes.Buffer
+	handler.encode(&b, r)
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	if handler.conn == nil {
+		return
+	}
+	_, err := handler.conn.Write(b.Bytes())
+	if journalTooLarge(err) {
+		err = sendJournalFile(handler.conn, b.Bytes())
+	}
+	if err != nil {
+		reportError(handler.errors, fmt.Errorf("logging journal error: %v", err))
+	}
+}
+
+// encode writes the record as a journal entry.
+func (handler *JournalHandler) encode(b *bytes.Buffer, r *Record) {
+	identifier := handler.identifier
+	if identifier == "" {
+		identifier = r.Name()
+	}
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+	writeJournalField(b, "MESSAGE", r.Message())
+	writeJournalField(b, "PRIORITY", strconv.Itoa(SyslogSeverity(r.level)))
+	writeJournalField(b, "SYSLOG_IDENTIFIER", identifier)
+	if r.Pathname() != errString {
+		writeJournalField(b, "CODE_FILE", r.Pathname())
+		writeJournalField(b, "CODE_LINE", strconv.Itoa(r.Lineno()))
+		writeJournalField(b, "CODE_FUNC", r.Funcname())
+	}
+	for i := 0; i+1 < len(r.context); i += 2 {
+		name := journalName(fmt.Sprint(r.context[i]))
+		if journalFields[name] {
+			name = "CTX_" + name
+		}
+		if name != "" {
+			writeJournalField(b, name, fmt.Sprint(r.context[i+1]))
+		}
+	}
+}
+
+// writeJournalField writes a field as NAME=value, or as NAME, the length in
+// 64-bit little endian and the value if the value has newlines.
+func writeJournalField(b *bytes.Buffer, name string, value string) {
+	b.WriteString(name)
+	if strings.IndexByte(value, '\n') < 0 {
+		b.WriteByte('=')
+	} else {
+		b.WriteByte('\n')
+		binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	}
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalName returns a name of journal fields for key, which has at most 64
+// upper case letters, digits and underscores, and starts with a letter, or
+// "" if there is none.
+func journalName(key string) string {
+	b := []byte(strings.ToUpper(key))
+	for i, c := range b {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	name := strings.TrimLeft(string(b), "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// Runtime reports that the caller of records is needed.
+func (handler *JournalHandler) Runtime() bool {
+	return true
+}
+
+// Flush does nothing, because records are written when handled.
+func (handler *JournalHandler) Flush() {
+}
+
+// Close closes the connection to the journal.
+func (handler *JournalHandler) Close() {
+	atomic.StoreInt32(&handler.closed, 1)
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	if handler.conn != nil {
+		handler.conn.Close()
+		handler.conn = nil
+	}
+}
+
+// Getter functions
+
+func (handler *JournalHandler) Level() Level {
+	return Level(atomic.LoadInt32((*int32)(&handler.level)))
+}
+
+// Setter functions
+
+func (handler *JournalHandler) SetLevel(level Level) {
+	atomic.StoreInt32((*int32)(&handler.level), int32(level))
+}
+
+// SetErrors sets the channel receiving the errors of writing entries, which
+// are dropped if it is full or nil.
+func (handler *JournalHandler) SetErrors(errors chan<- error) {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	handler.errors = errors
+}
@@ -0,0 +1,111 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+//go:build linux
+// +build linux
+
+package logging
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Numbers of the memfd_create system call, which are not in syscall
+var sysMemfdCreate = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"mips":     4354,
+	"mipsle":   4354,
+	"mips64":   5314,
+	"mips64le": 5314,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"riscv64":  279,
+	"s390x":    350,
+}
+
+// Flags of memfd_create and F_ADD_SEALS
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fAddSeals       = 1033
+	fSealSeal       = 0x1
+	fSealShrink     = 0x2
+	fSealGrow       = 0x4
+	fSealWrite      = 0x8
+)
+
+// journalTooLarge reports whether err is the error of writing an entry too
+// large for a datagram.
+func journalTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE)
+}
+
+// sendJournalFile writes the entry to a sealed memfd, or to an unlinked file
+// in /dev/shm if memfd is not available, and passes it to the journal, for
+// entries too large for a datagram.
+func sendJournalFile(conn *net.UnixConn, data []byte) error {
+	file, err := memfd()
+	if err != nil {
+		if file, err = ioutil.TempFile("/dev/shm", "logging"); err != nil {
+			return err
+		}
+		os.Remove(file.Name())
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	fd := file.Fd()
+	syscall.Syscall(syscall.SYS_FCNTL, fd, fAddSeals, fSealSeal|fSealShrink|fSealGrow|fSealWrite)
+	// WriteMsgUnix refuses connected datagram sockets, so sendmsg is
+	// called directly.
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	werr := raw.Write(func(s uintptr) bool {
+		err = syscall.Sendmsg(int(s), nil, syscall.UnixRights(int(fd)), nil, 0)
+		return err != syscall.EAGAIN
+	})
+	if werr != nil {
+		return werr
+	}
+	return err
+}
+
+// memfd creates a memfd which can be sealed.
+func memfd() (*os.File, error) {
+	trap, ok := sysMemfdCreate[runtime.GOARCH]
+	if !ok {
+		return nil, syscall.ENOSYS
+	}
+	name := []byte("logging\x00")
+	fd, _, errno := syscall.Syscall(trap, uintptr(unsafe.Pointer(&name[0])), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return os.NewFile(fd, "logging"), nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJournalHandler(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logging")
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer conn.Close()
+	conn.SetReadBuffer(1 << 20)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	logger, _ := WriterLogger("journal", DEBUG, BasicFormat, DefaultTimeFormat, ioutil.Discard, true)
+	defer logger.Destroy()
+	handler, err := newJournalHandler(INFO, "", socket)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	logger.AddHandler(handler)
+	logger.Debug("dropped")
+	logger.With("request-id", 7, "_trusted", "x", "", "y", "message", "m", "priority", 9).Warning("two\nlines")
+	buf := make([]byte, 1<<20)
+	n, _ := conn.Read(buf)
+	expected := "MESSAGE\n\x09\x00\x00\x00\x00\x00\x00\x00two\nlines\nPRIORITY=4\nSYSLOG_IDENTIFIER=journal\nCODE_FILE="
+	if !bytes.HasPrefix(buf[:n], []byte(expected)) ||
+		!bytes.Contains(buf[:n], []byte("CODE_FUNC=TestJournalHandler\n")) ||
+		!bytes.HasSuffix(buf[:n], []byte("\nREQUEST_ID=7\nTRUSTED=x\nCTX_MESSAGE=m\nCTX_PRIORITY=9\n")) {
+		t.Errorf("%q\n", buf[:n])
+	}
+
+	// no code fields for a record without a caller
+	r := Record{level: WARNING, args: []interface{}{"no caller"}}
+	r.genNonRuntime(logger)
+	handler.Handle(&r)
+	n, _ = conn.Read(buf)
+	if !bytes.HasPrefix(buf[:n], []byte("MESSAGE=no caller\n")) || bytes.Contains(buf[:n], []byte("CODE_")) {
+		t.Errorf("%q\n", buf[:n])
+	}
+
+	large := strings.Repeat("x", 1<<20)
+	logger.Error(large)
+	oob := make([]byte, 64)
+	_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	msgs, _ := syscall.ParseSocketControlMessage(oob[:oobn])
+	if len(msgs) != 1 {
+		t.Fatalf("%v\n", msgs)
+	}
+	fds, _ := syscall.ParseUnixRights(&msgs[0])
+	file := os.NewFile(uintptr(fds[0]), "memfd")
+	file.Seek(0, 0)
+	data, _ := ioutil.ReadAll(file)
+	file.Close()
+	if !bytes.HasPrefix(data, []byte("MESSAGE="+large+"\nPRIORITY=3\n")) {
+		t.Errorf("%d\n", len(data))
+	}
+
+	errs := make(chan error, 1)
+	handler.SetErrors(errs)
+	conn.Close()
+	logger.Error("lost")
+	select {
+	case err := <-errs:
+		if !strings.HasPrefix(err.Error(), "logging journal error: ") {
+			t.Errorf("%v\n", err)
+		}
+	default:
+		t.Errorf("%v\n", "no error reported")
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+//go:build !linux
+// +build !linux
+
+package logging
+
+import (
+	"errors"
+	"net"
+)
+
+// journalTooLarge reports false, because entries are only passed in files on
+// linux.
+func journalTooLarge(err error) bool {
+	return false
+}
+
+// sendJournalFile fails, because memfd is only available on linux.
+func sendJournalFile(conn *net.UnixConn, data []byte) error {
+	return errors.New("logging journal error: entry too large")
+}
@@ -0,0 +1,177 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// JSONEncoder encodes each record as a JSON object. The fields of the record
+// are written in a fixed order with the field names as keys, unless other
+// keys are set by SetKey. The "ctx" field is written as a nested object of the
+// key/value pairs attached by With.
+type JSONEncoder struct {
+	fields  []string          // fields to write, in order
+	funcs   []fieldFunc       // functions of the fields
+	keys    map[string]string // keys of the fields, if not the field names
+	runtime bool              // with runtime fields or not
+}
+
+// NewJSONEncoder creates a JSON encoder writing the fields, or all the fields
+// if none is given.
+func NewJSONEncoder(names ...string) (*JSONEncoder, error) {
+	names, funcs, runtime, err := parseFields(names)
+	if err != nil {
+		return nil, err
+	}
+	encoder := new(JSONEncoder)
+	encoder.fields = names
+	encoder.funcs = funcs
+	encoder.keys = make(map[string]string)
+	encoder.runtime = runtime
+	return encoder, nil
+}
+
+// SetKey sets the key of a field in the JSON objects. It should be called
+// before the encoder is used by handlers.
+func (encoder *JSONEncoder) SetKey(field string, key string) {
+	encoder.keys[field] = key
+}
+
+// Fields returns the fields written by the encoder.
+func (encoder *JSONEncoder) Fields() []string {
+	return encoder.fields
+}
+
+// Runtime reports whether the encoder has runtime fields.
+func (encoder *JSONEncoder) Runtime() bool {
+	return encoder.runtime
+}
+
+// Encode writes the record as a JSON object.
+func (encoder *JSONEncoder) Encode(b *bytes.Buffer, r *Record) {
+	b.WriteByte('{')
+	for i, name := range encoder.fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, ok := encoder.keys[name]
+		if !ok {
+			key = name
+		}
+		writeJSONString(b, key)
+		b.WriteByte(':')
+		if name == "ctx" {
+			writeJSONContext(b, r.context)
+		} else {
+			writeJSONValue(b, encoder.funcs[i](r.logger, r))
+		}
+	}
+	b.WriteByte('}')
+}
+
+// writeJSONContext writes key/value pairs as a JSON object.
+func writeJSONContext(b *bytes.Buffer, context []interface{}) {
+	b.WriteByte('{')
+	for i := 0; i+1 < len(context); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeJSONString(b, fmt.Sprint(context[i]))
+		b.WriteByte(':')
+		writeJSONValue(b, context[i+1])
+	}
+	b.WriteByte('}')
+}
+
+// writeJSONValue writes a value in JSON. Errors are written as their
+// messages, and values that can't be marshaled as their fmt.Sprint strings.
+func writeJSONValue(b *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case string:
+		writeJSONString(b, v)
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case int:
+		b.WriteString(strconv.FormatInt(int64(v), 10))
+	case int32:
+		b.WriteString(strconv.FormatInt(int64(v), 10))
+	case int64:
+		b.WriteString(strconv.FormatInt(v, 10))
+	case uint64:
+		b.WriteString(strconv.FormatUint(v, 10))
+	case error:
+		writeJSONString(b, v.Error())
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			writeJSONString(b, fmt.Sprint(v))
+		} else {
+			b.Write(data)
+		}
+	}
+}
+
+// writeJSONString writes a string in JSON with the special characters
+// escaped. Invalid UTF-8 bytes are replaced by U+FFFD.
+func writeJSONString(b *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c == '\n':
+				b.WriteString(`\n`)
+			case c == '\r':
+				b.WriteString(`\r`)
+			case c == '\t':
+				b.WriteString(`\t`)
+			case c < 0x20:
+				b.WriteString(`\u00`)
+				b.WriteByte(hex[c>>4])
+				b.WriteByte(hex[c&0xf])
+			default:
+				b.WriteByte(c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b.WriteString(`\ufffd`)
+		case r == '\u2028':
+			b.WriteString(`\u2028`)
+		case r == '\u2029':
+			b.WriteString(`\u2029`)
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	b.WriteByte('"')
+}
@@ -16,6 +16,13 @@
 
 package logging
 
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
 // Level is the type of level.
 type Level int32
 
@@ -44,6 +51,7 @@ var levelNames = map[Level]string{
 // The mapping from level name to level
 var levelValues = map[string]Level{
 	"CRITICAL": CRITICAL,
+	"FATAL":    FATAL,
 	"ERROR":    ERROR,
 	"WARN":     WARNING,
 	"WARNING":  WARNING,
@@ -52,17 +60,87 @@ var levelValues = map[string]Level{
 	"NOTSET":   NOTSET,
 }
 
-// String function casts level value to string
-func (level *Level) String() string {
-	return levelNames[*level]
+// levelsLock protects levelNames and levelValues, which are written by
+// RegisterLevel.
+var levelsLock sync.RWMutex
+
+// RegisterLevel registers a custom level, e.g. RegisterLevel(5, "TRACE"), so
+// that it has a name in records and can be parsed by ParseLevel. Names are
+// case-insensitive and stored in upper case. Registering an existing value
+// renames the level, while the old name still parses to it.
+func RegisterLevel(level Level, name string) {
+	name = strings.ToUpper(name)
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+	levelNames[level] = name
+	levelValues[name] = level
+}
+
+// ParseLevel returns the level of a name, which is case-insensitive, or of
+// a number. It returns an error for an unknown name.
+func ParseLevel(s string) (Level, error) {
+	name := strings.ToUpper(strings.TrimSpace(s))
+	levelsLock.RLock()
+	level, ok := levelValues[name]
+	levelsLock.RUnlock()
+	if ok {
+		return level, nil
+	}
+	n, err := strconv.ParseInt(name, 10, 32)
+	if err != nil {
+		return NOTSET, errors.New("logging level error: " + s)
+	}
+	return Level(n), nil
+}
+
+// String function casts level value to string. Levels without a name are
+// written as numbers.
+func (level Level) String() string {
+	levelsLock.RLock()
+	name, ok := levelNames[level]
+	levelsLock.RUnlock()
+	if !ok {
+		return strconv.Itoa(int(level))
+	}
+	return name
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (level Level) MarshalText() ([]byte, error) {
+	return []byte(level.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler by ParseLevel.
+func (level *Level) UnmarshalText(text []byte) error {
+	l, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*level = l
+	return nil
+}
+
+// Set implements flag.Value by ParseLevel, so that a level can be a flag.
+//
+// Example:
+//
+//	level := logging.WARNING
+//	flag.Var(&level, "level", "logging level")
+func (level *Level) Set(s string) error {
+	return level.UnmarshalText([]byte(s))
 }
 
 // GetLevelName lets users be able to get level name from level value.
 func GetLevelName(levelValue Level) string {
+	levelsLock.RLock()
+	defer levelsLock.RUnlock()
 	return levelNames[levelValue]
 }
 
-// GetLevelValue lets users be able to get level value from level name.
+// GetLevelValue lets users be able to get level value from level name, which
+// is case-insensitive. It returns NOTSET for unknown names, which can be told
+// by ParseLevel.
 func GetLevelValue(levelName string) Level {
-	return levelValues[levelName]
+	level, _ := ParseLevel(levelName)
+	return level
 }
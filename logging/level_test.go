@@ -0,0 +1,94 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"testing"
+)
+
+// saveLevels returns a function restoring the registered levels, so that the
+// levels registered by a test don't leak into the others.
+func saveLevels() func() {
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+	names := make(map[Level]string, len(levelNames))
+	for k, v := range levelNames {
+		names[k] = v
+	}
+	values := make(map[string]Level, len(levelValues))
+	for k, v := range levelValues {
+		values[k] = v
+	}
+	return func() {
+		levelsLock.Lock()
+		defer levelsLock.Unlock()
+		levelNames, levelValues = names, values
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	defer saveLevels()()
+	RegisterLevel(5, "trace")
+	tests := map[string]Level{
+		"debug":   DEBUG,
+		"Warn":    WARNING,
+		" INFO ":  INFO,
+		"TRACE":   5,
+		"25":      25,
+		"fatal":   CRITICAL,
+		"notset":  NOTSET,
+		"unknown": -1,
+	}
+	for name, expected := range tests {
+		level, err := ParseLevel(name)
+		if expected < 0 && err == nil || expected >= 0 && (err != nil || level != expected) {
+			t.Errorf("%q: %v, %v, %v\n", name, level, err, expected)
+		}
+	}
+	if s := fmt.Sprint(DEBUG, Level(5), Level(25)); s != "DEBUG TRACE 25" {
+		t.Errorf("%v\n", s)
+	}
+	var config struct{ Level Level }
+	if err := json.Unmarshal([]byte(`{"Level":"error"}`), &config); err != nil || config.Level != ERROR {
+		t.Errorf("%v, %v\n", config.Level, err)
+	}
+	data, _ := json.Marshal(config)
+	if string(data) != `{"Level":"ERROR"}` {
+		t.Errorf("%s\n", data)
+	}
+	level := WARNING
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(&level, "level", "logging level")
+	if err := flags.Parse([]string{"-level", "trace"}); err != nil || level != 5 {
+		t.Errorf("%v, %v\n", level, err)
+	}
+	if GetLevelValue("info") != INFO || GetLevelName(5) != "TRACE" {
+		t.Errorf("%v, %v\n", GetLevelValue("info"), GetLevelName(5))
+	}
+}
+
+func TestRestoreLevels(t *testing.T) {
+	restore := saveLevels()
+	RegisterLevel(5, "trace")
+	restore()
+	if _, err := ParseLevel("trace"); err == nil || GetLevelName(5) != "" {
+		t.Errorf("%v, %q\n", err, GetLevelName(5))
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// LogfmtEncoder encodes each record as a line of logfmt, key=value pairs
+// separated by spaces. The fields of the record are written in a fixed order
+// with the field names as keys, unless other keys are set by SetKey. The
+// "ctx" field is written as the key/value pairs attached by With.
+type LogfmtEncoder struct {
+	fields  []string          // fields to write, in order
+	funcs   []fieldFunc       // functions of the fields
+	keys    map[string]string // keys of the fields, if not the field names
+	runtime bool              // with runtime fields or not
+}
+
+// NewLogfmtEncoder creates a logfmt encoder writing the fields, or all the
+// fields if none is given.
+func NewLogfmtEncoder(names ...string) (*LogfmtEncoder, error) {
+	names, funcs, runtime, err := parseFields(names)
+	if err != nil {
+		return nil, err
+	}
+	encoder := new(LogfmtEncoder)
+	encoder.fields = names
+	encoder.funcs = funcs
+	encoder.keys = make(map[string]string)
+	encoder.runtime = runtime
+	return encoder, nil
+}
+
+// SetKey sets the key of a field. It should be called before the encoder is
+// used by handlers.
+func (encoder *LogfmtEncoder) SetKey(field string, key string) {
+	encoder.keys[field] = key
+}
+
+// Fields returns the fields written by the encoder.
+func (encoder *LogfmtEncoder) Fields() []string {
+	return encoder.fields
+}
+
+// Runtime reports whether the encoder has runtime fields.
+func (encoder *LogfmtEncoder) Runtime() bool {
+	return encoder.runtime
+}
+
+// Encode writes the record as logfmt.
+func (encoder *LogfmtEncoder) Encode(b *bytes.Buffer, r *Record) {
+	first := true
+	for i, name := range encoder.fields {
+		if name == "ctx" {
+			for i := 0; i+1 < len(r.context); i += 2 {
+				writeLogfmtPair(b, &first, fmt.Sprint(r.context[i]), r.context[i+1])
+			}
+			continue
+		}
+		key, ok := encoder.keys[name]
+		if !ok {
+			key = name
+		}
+		writeLogfmtPair(b, &first, key, encoder.funcs[i](r.logger, r))
+	}
+}
+
+// writeLogfmtPair writes a key=value pair, preceded by a space unless it is
+// the first one.
+func writeLogfmtPair(b *bytes.Buffer, first *bool, key string, value interface{}) {
+	if !*first {
+		b.WriteByte(' ')
+	}
+	*first = false
+	writeLogfmtKey(b, key)
+	b.WriteByte('=')
+	var s string
+	switch v := value.(type) {
+	case nil:
+		s = "null"
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if needsLogfmtQuote(s) {
+		writeJSONString(b, s)
+	} else {
+		b.WriteString(s)
+	}
+}
+
+// writeLogfmtKey writes a key with the characters that are not allowed in
+// logfmt keys replaced by underscores.
+func writeLogfmtKey(b *bytes.Buffer, key string) {
+	if key == "" {
+		b.WriteByte('_')
+		return
+	}
+	for _, c := range key {
+		if c <= ' ' || c == '=' || c == '"' || c == utf8.RuneError {
+			b.WriteByte('_')
+		} else {
+			b.WriteRune(c)
+		}
+	}
+}
+
+// needsLogfmtQuote reports whether a value has to be quoted in logfmt.
+func needsLogfmtQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	if !utf8.ValidString(s) {
+		return true
+	}
+	return strings.IndexFunc(s, func(c rune) bool {
+		return c <= ' ' || c == '=' || c == '"' || c == '\\' || c == 0x7f
+	}) >= 0
+}
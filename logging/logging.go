@@ -25,14 +25,15 @@
 //	logger.Error("test for error")
 //	logger.Warning("test for warning", "second parameter")
 //	logger.Debug("test for debug")
-//
 package logging
 
 import (
+	"errors"
 	"github.com/ccding/go-config-reader/config"
 	"io"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -43,13 +44,21 @@ const (
 	DefaultFileName     = "logging.log"                   // default logging filename
 	DefaultTimeFormat   = "2006-01-02 15:04:05.999999999" // defaulttime format
 	DefaultBufferSize   = 1000                            // default buffer size for writer
-	DefaultQueueSize    = 10000                           // default chan queue size in async logging
+	DefaultQueueSize    = 10000                           // default queue size of records with runtime fields, added to the request size
 	DefaultRequestSize  = 10000                           // default chan queue size in async logging
 	DefaultTimeInterval = 100                             // default time interval in milliseconds in async logging
 )
 
 // Logger is the logging struct.
 type Logger struct {
+	*core // state shared with the loggers derived by With
+
+	context []interface{} // key/value pairs attached to every record
+}
+
+// core holds the state of a logger. Loggers derived by With point to the
+// same core, so they share the handlers, level, and seqid of the logger.
+type core struct {
 
 	// Be careful of the alignment issue of the variable seqid because it
 	// uses the sync/atomic.AddUint64() operation. If the alignment is
@@ -59,30 +68,22 @@ type Logger struct {
 	seqid uint64 // last used sequence number in record
 
 	// These variables can be configured by users.
-	name         string    // logger name
-	level        Level     // record level higher than this will be printed
-	recordFormat string    // format of the record
-	recordArgs   []string  // arguments to be used in the recordFormat
-	out          io.Writer // writer
-	sync         bool      // use sync or async way to record logs
-	timeFormat   string    // format for time
+	name       string         // logger name
+	level      Level          // record level higher than this will be printed
+	propagate  int32          // pass records to the parent or not
+	handler    *WriterHandler // handler created with the logger, nil for a child
+	handlers   atomic.Value   // []Handler to write records, including handler
+	filterList                // filters to check records
+	exitFunc   func(int)      // function called by Fatal, nil to inherit
+	modules    atomic.Value   // *moduleLevels set by SetModuleLevels
 
 	// These variables are visible to users.
 	startTime time.Time // start time of the logger
 
 	// Internally used variables, which don't have get and set functions.
-	wlock   sync.Mutex   // writer lock
-	queue   chan string  // queue used in async logging
-	request chan request // queue used in non-runtime logging
-	flush   chan bool    // flush signal for the watcher to write
-	finish  chan bool    // finish flush signal for the flush function to return
-	quit    chan bool    // quit signal for the watcher to quit
-	fd      *os.File     // file handler, used to close the file on destroy
-	runtime bool         // with runtime operation or not
-
-	// The customized configurations.
-	bufferSize   int
-	timeInterval time.Duration
+	lock    sync.Mutex // lock of changing handlers
+	parent  *Logger    // parent in the logger hierarchy, nil for a root
+	destroy sync.Once  // make Destroy run only once
 }
 
 // SimpleLogger creates a new logger with simple configuration.
@@ -102,17 +103,37 @@ func RichLogger(name string) (*Logger, error) {
 
 // FileLogger creates a new logger with file output.
 func FileLogger(name string, level Level, format string, timeFormat string, file string, sync bool) (*Logger, error) {
-	out, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, os.ModeAppend|0644)
+	handler, err := NewFileHandler(NOTSET, format, timeFormat, file, sync)
 	if err != nil {
 		return nil, err
 	}
-	logger, err := createLogger(name, level, format, timeFormat, out, sync)
-	if err == nil {
-		logger.fd = out
-		return logger, nil
-	} else {
+	logger := newLogger(name, level, handler)
+	register(logger)
+	return logger, nil
+}
+
+// RotatingFileLogger creates a new logger with file output, which is rotated
+// when it would grow over maxSize bytes, keeping at most maxBackups backups.
+func RotatingFileLogger(name string, level Level, format string, timeFormat string, file string, sync bool, maxSize int64, maxBackups int) (*Logger, error) {
+	handler, err := NewRotatingFileHandler(NOTSET, format, timeFormat, file, sync, maxSize, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	logger := newLogger(name, level, handler)
+	register(logger)
+	return logger, nil
+}
+
+// TimedFileLogger creates a new logger with output to files named by the
+// pattern, which are rotated every period. See TimedFileWriter.
+func TimedFileLogger(name string, level Level, format string, timeFormat string, pattern string, sync bool, period Period, symlink string, utc bool) (*Logger, error) {
+	handler, err := NewTimedFileHandler(NOTSET, format, timeFormat, pattern, sync, period, symlink, utc)
+	if err != nil {
 		return nil, err
 	}
+	logger := newLogger(name, level, handler)
+	register(logger)
+	return logger, nil
 }
 
 // WriterLogger creates a new logger with a writer
@@ -121,11 +142,29 @@ func WriterLogger(name string, level Level, format string, timeFormat string, ou
 }
 
 // CustomizedLogger creates a new logger with all configurations customized
-// (in addition to WriterLogger).
+// (in addition to WriterLogger). Records with runtime fields, which were
+// queued up to queueSize apart from the others, are queued with them now, so
+// the queue holds up to queueSize+requestSize records.
 func CustomizedLogger(name string, level Level, format string, timeFormat string, out io.Writer, sync bool, queueSize int, requestSize int, bufferSize int, timeInterval time.Duration) (*Logger, error) {
+	if queueSize < 0 || requestSize < 0 {
+		return nil, errors.New("logging queue error: negative size")
+	}
 	return createCustomizedLogger(name, level, format, timeFormat, out, sync, queueSize, requestSize, bufferSize, timeInterval)
 }
 
+// HandlerLogger creates a new logger writing only to the given handlers, e.g.
+// a NetHandler or an HTTPHandler, without a handler of its own, so that the
+// getter and setter functions of the record format and writer don't apply.
+func HandlerLogger(name string, level Level, handlers ...Handler) (*Logger, error) {
+	if len(handlers) == 0 {
+		return nil, errors.New("logging handler error: no handlers for " + name)
+	}
+	logger := newLogger(name, level, nil)
+	logger.handlers.Store(append([]Handler(nil), handlers...))
+	register(logger)
+	return logger, nil
+}
+
 // ConfigLogger creates a new logger from a configuration file
 func ConfigLogger(filename string) (*Logger, error) {
 	conf := config.NewConfig(filename)
@@ -138,11 +177,10 @@ func ConfigLogger(filename string) (*Logger, error) {
 	if slevel == "" {
 		slevel = "0"
 	}
-	l, err := strconv.Atoi(slevel)
+	level, err := ParseLevel(slevel)
 	if err != nil {
 		return nil, err
 	}
-	level := Level(l)
 	format := conf.Get("", "format")
 	if format == "" {
 		format = BasicFormat
@@ -167,70 +205,226 @@ func ConfigLogger(filename string) (*Logger, error) {
 	} else {
 		return nil, err
 	}
-	return FileLogger(name, level, format, timeFormat, file, sync)
+	encoder, err := newEncoder(conf.Get("", "encoder"), conf.Get("", "fields"))
+	if err != nil {
+		return nil, err
+	}
+	var watch time.Duration
+	if swatch := conf.Get("", "watch"); swatch != "" {
+		watch, err = time.ParseDuration(swatch)
+		if err != nil {
+			return nil, err
+		}
+	}
+	maxSize, err := parseSize(conf.Get("", "maxSize"))
+	if err != nil {
+		return nil, err
+	}
+	maxBackups := 0
+	if smaxBackups := conf.Get("", "maxBackups"); smaxBackups != "" {
+		maxBackups, err = strconv.Atoi(smaxBackups)
+		if err != nil {
+			return nil, err
+		}
+	}
+	retention := Retention{Compress: conf.Get("", "compress")}
+	retention.MaxBytes, err = parseSize(conf.Get("", "maxTotalSize"))
+	if err != nil {
+		return nil, err
+	}
+	if smaxAge := conf.Get("", "maxAge"); smaxAge != "" {
+		retention.MaxAge, err = time.ParseDuration(smaxAge)
+		if err != nil {
+			return nil, err
+		}
+	}
+	overflow, err := parseOverflow(conf.Get("", "overflow"))
+	if err != nil {
+		return nil, err
+	}
+	var overflowTimeout time.Duration
+	if stimeout := conf.Get("", "overflowTimeout"); stimeout != "" {
+		overflowTimeout, err = time.ParseDuration(stimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	queueBytes, err := parseSize(conf.Get("", "queueBytes"))
+	if err != nil {
+		return nil, err
+	}
+	var logger *Logger
+	if srotate := conf.Get("", "rotate"); srotate != "" {
+		retention.MaxBackups = maxBackups
+		var period Period
+		period, err = parsePeriod(srotate)
+		if err == nil {
+			utc := conf.Get("", "utc") == "1"
+			logger, err = TimedFileLogger(name, level, format, timeFormat, file, sync, period, conf.Get("", "symlink"), utc)
+		}
+	} else if maxSize > 0 {
+		logger, err = RotatingFileLogger(name, level, format, timeFormat, file, sync, maxSize, maxBackups)
+	} else {
+		logger, err = FileLogger(name, level, format, timeFormat, file, sync)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if retention != (Retention{}) {
+		if err := logger.handler.SetRetention(retention); err != nil {
+			logger.Destroy()
+			return nil, err
+		}
+	}
+	logger.SetEncoder(encoder)
+	logger.SetOverflow(overflow, overflowTimeout)
+	logger.SetQueueBytes(queueBytes)
+	logger.SetDropReport(conf.Get("", "dropReport") == "1")
+	if watch > 0 {
+		logger.handler.Watch(watch)
+	}
+	return logger, nil
+}
+
+// parseSize parses a size in bytes, which may have a suffix K, M or G, e.g.
+// "10M". An empty size is 0.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	unit := int64(1)
+	switch s[len(s)-1] {
+	case 'K':
+		unit = 1 << 10
+	case 'M':
+		unit = 1 << 20
+	case 'G':
+		unit = 1 << 30
+	}
+	if unit > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errors.New("logging size error: " + s)
+	}
+	return n * unit, nil
 }
 
 // createLogger create a new logger
 func createLogger(name string, level Level, format string, timeFormat string, out io.Writer, sync bool) (*Logger, error) {
-	return createCustomizedLogger(name, level, format, timeFormat, out, sync, DefaultQueueSize, DefaultRequestSize, DefaultBufferSize, DefaultTimeInterval)
+	return createCustomizedLogger(name, level, format, timeFormat, out, sync, 0, DefaultRequestSize, DefaultBufferSize, DefaultTimeInterval)
 }
 
 // createCustomizedLogger create a new logger with customizing queue size and request size
 func createCustomizedLogger(name string, level Level, format string, timeFormat string, out io.Writer, sync bool, queueSize int, requestSize int, bufferSize int, timeInterval time.Duration) (*Logger, error) {
-	logger := new(Logger)
-
-	err := logger.parseFormat(format)
+	handler, err := NewCustomizedHandler(NOTSET, format, timeFormat, out, sync, queueSize+requestSize, bufferSize, timeInterval)
 	if err != nil {
 		return nil, err
 	}
+	logger := newLogger(name, level, handler)
+	register(logger)
+	return logger, nil
+}
+
+// newLogger creates a new logger writing to handler, or to its ancestors
+// only if handler is nil.
+func newLogger(name string, level Level, handler *WriterHandler) *Logger {
+	logger := new(Logger)
+	logger.core = new(core)
 
 	// assign values to logger
 	logger.name = name
 	logger.level = level
-	logger.out = out
+	logger.propagate = 1
 	logger.seqid = 0
-	logger.sync = sync
-	logger.queue = make(chan string, queueSize)
-	logger.request = make(chan request, requestSize)
-	logger.flush = make(chan bool)
-	logger.finish = make(chan bool)
-	logger.quit = make(chan bool)
 	logger.startTime = time.Now()
-	logger.fd = nil
-	logger.timeFormat = timeFormat
-	logger.bufferSize = bufferSize
-	logger.timeInterval = timeInterval
-
-	// start watcher to write logs if it is async or no runtime field
-	if !logger.sync {
-		go logger.watcher()
+	if handler != nil {
+		logger.handler = handler
+		logger.handlers.Store([]Handler{handler})
 	}
-
-	return logger, nil
+	return logger
 }
 
-// Destroy sends quit signal to watcher and releases all the resources.
+// Destroy closes all the handlers of the logger, which makes the watchers
+// quit and releases all the resources. Calls after the first one do nothing.
 func (logger *Logger) Destroy() {
-	if !logger.sync {
-		// quit watcher
-		logger.quit <- true
-		// wait for watcher quit
-		<-logger.quit
+	logger.destroy.Do(func() {
+		unregister(logger)
+		for _, handler := range logger.Handlers() {
+			handler.Close()
+		}
+	})
+}
+
+// With returns a logger that shares the handlers, level, and seqid of
+// logger, and attaches the key/value pairs kv to every record it logs. The
+// pairs are rendered by the "ctx" field of the record format. Destroying the
+// returned logger destroys logger as well.
+func (logger *Logger) With(kv ...interface{}) *Logger {
+	context := make([]interface{}, 0, len(logger.context)+len(kv)+1)
+	context = append(context, logger.context...)
+	context = append(context, kv...)
+	if len(kv)%2 != 0 {
+		// the last key has no value
+		context = append(context, errString)
 	}
-	// clean up
-	if logger.fd != nil {
-		logger.fd.Close()
+	return &Logger{core: logger.core, context: context}
+}
+
+// GetChild returns a new logger named "<name>.<suffix>" whose parent is logger.
+// The child has no handler of its own and its level is NOTSET, so it uses the
+// effective level of its ancestors and propagates its records to them until
+// SetLevel, SetWriter, AddHandler, or SetPropagate is called on it.
+func (logger *Logger) GetChild(suffix string) *Logger {
+	name := suffix
+	if logger.name != "" {
+		name = logger.name + "." + suffix
 	}
+	child := newLogger(name, NOTSET, nil)
+	child.context = logger.context
+	child.parent = logger
+	return child
 }
 
-// Flush the writer
+// Flush flushes all the handlers of the logger.
 func (logger *Logger) Flush() {
-	if !logger.sync {
-		// send flush signal
-		logger.flush <- true
-		// wait for the flush finish
-		<-logger.finish
+	for _, handler := range logger.Handlers() {
+		handler.Flush()
+	}
+}
+
+// AddHandler adds a handler to the logger. The handlers can be changed
+// while other goroutines log, because the list is replaced rather than
+// changed.
+func (logger *Logger) AddHandler(handler Handler) {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	old := logger.Handlers()
+	handlers := make([]Handler, len(old), len(old)+1)
+	copy(handlers, old)
+	logger.handlers.Store(append(handlers, handler))
+}
+
+// AddFilter adds a filter to the logger. Records which don't pass all the
+// filters of the logger are dropped before they are passed to any handler.
+func (logger *Logger) AddFilter(filter Filter) {
+	logger.filterList.AddFilter(filter)
+}
+
+// RemoveHandler removes a handler from the logger without closing it.
+func (logger *Logger) RemoveHandler(handler Handler) {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	old := logger.Handlers()
+	handlers := make([]Handler, 0, len(old))
+	for _, h := range old {
+		if h != handler {
+			handlers = append(handlers, h)
+		}
 	}
+	logger.handlers.Store(handlers)
 }
 
 // Getter functions
@@ -243,28 +437,111 @@ func (logger *Logger) StartTime() int64 {
 	return logger.startTime.UnixNano()
 }
 
+// The getter functions of the record format, time format, writer and sync
+// return the configuration of the handler created with the logger.
+
 func (logger *Logger) TimeFormat() string {
-	return logger.timeFormat
+	handler := logger.Handler()
+	if handler == nil {
+		return ""
+	}
+	return handler.timeFormat
 }
 
 func (logger *Logger) Level() Level {
 	return Level(atomic.LoadInt32((*int32)(&logger.level)))
 }
 
+// EffectiveLevel returns the level of the nearest logger in the hierarchy,
+// starting from logger itself, whose level is not NOTSET.
+func (logger *Logger) EffectiveLevel() Level {
+	l := logger
+	for l.parent != nil && l.Level() == NOTSET {
+		l = l.parent
+	}
+	return l.Level()
+}
+
+func (logger *Logger) Parent() *Logger {
+	return logger.parent
+}
+
+func (logger *Logger) Propagate() bool {
+	return atomic.LoadInt32(&logger.propagate) != 0
+}
+
 func (logger *Logger) RecordFormat() string {
-	return logger.recordFormat
+	handler := logger.Handler()
+	if handler == nil {
+		return ""
+	}
+	return handler.RecordFormat()
 }
 
 func (logger *Logger) RecordArgs() []string {
-	return logger.recordArgs
+	handler := logger.Handler()
+	if handler == nil {
+		return nil
+	}
+	return handler.RecordArgs()
 }
 
 func (logger *Logger) Writer() io.Writer {
-	return logger.out
+	handler := logger.Handler()
+	if handler == nil {
+		return nil
+	}
+	return handler.Writer()
 }
 
 func (logger *Logger) Sync() bool {
-	return logger.sync
+	handler := logger.Handler()
+	if handler == nil {
+		return true
+	}
+	return handler.sync
+}
+
+// Dropped returns the number of records dropped by the handler created with
+// the logger when its queue is full.
+func (logger *Logger) Dropped() uint64 {
+	handler := logger.Handler()
+	if handler == nil {
+		return 0
+	}
+	return handler.Dropped()
+}
+
+// Handler returns the handler created with the logger, or nil if it has
+// none.
+func (logger *Logger) Handler() *WriterHandler {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	return logger.handler
+}
+
+func (logger *Logger) Handlers() []Handler {
+	handlers, _ := logger.handlers.Load().([]Handler)
+	return handlers
+}
+
+func (logger *Logger) Filters() []Filter {
+	return logger.filterList.Filters()
+}
+
+func (logger *Logger) Context() []interface{} {
+	return logger.context
+}
+
+// ExitFunc returns the function called by Fatal, which is the one set on the
+// logger or its nearest ancestor, or os.Exit if none is set.
+func (logger *Logger) ExitFunc() func(int) {
+	for l := logger; l != nil; l = l.parent {
+		if l.exitFunc != nil {
+			return l.exitFunc
+		}
+	}
+	return os.Exit
 }
 
 // Setter functions
@@ -273,6 +550,84 @@ func (logger *Logger) SetLevel(level Level) {
 	atomic.StoreInt32((*int32)(&logger.level), int32(level))
 }
 
+// SetWriter sets the writers of the handler created with the logger. A logger
+// without such a handler, e.g. one created by GetChild, gets a synchronous
+// handler with the format of its nearest ancestor which has one.
 func (logger *Logger) SetWriter(out ...io.Writer) {
-	logger.out = io.MultiWriter(out...)
+	logger.lock.Lock()
+	handler := logger.handler
+	if handler == nil {
+		layout, timeFormat := basicLayout, DefaultTimeFormat
+		for l := logger.parent; l != nil; l = l.parent {
+			if h := l.Handler(); h != nil {
+				layout, timeFormat = h.getLayout(), h.timeFormat
+				break
+			}
+		}
+		handler = newWriterHandler(NOTSET, layout, timeFormat, nil, true, DefaultRequestSize, DefaultBufferSize, DefaultTimeInterval)
+		logger.handler = handler
+		old := logger.Handlers()
+		handlers := make([]Handler, len(old), len(old)+1)
+		copy(handlers, old)
+		logger.handlers.Store(append(handlers, Handler(handler)))
+	}
+	logger.lock.Unlock()
+	handler.SetWriter(out...)
+}
+
+// SetEncoder sets the encoder of the handler created with the logger, which
+// is used to write records instead of the record format.
+func (logger *Logger) SetEncoder(encoder Encoder) {
+	if handler := logger.Handler(); handler != nil {
+		handler.SetEncoder(encoder)
+	}
+}
+
+// SetFormat sets the record format of the handler created with the logger.
+func (logger *Logger) SetFormat(format string) error {
+	handler := logger.Handler()
+	if handler == nil {
+		return errors.New("logging handler error: " + logger.name)
+	}
+	return handler.SetFormat(format)
+}
+
+// SetOverflow sets the policy of the handler created with the logger when its
+// queue is full, with the timeout of OverflowBlockTimeout.
+func (logger *Logger) SetOverflow(overflow Overflow, timeout time.Duration) {
+	if handler := logger.Handler(); handler != nil {
+		handler.SetOverflow(overflow, timeout)
+	}
+}
+
+// SetQueueBytes bounds the queue of the handler created with the logger by
+// the estimated bytes of its records, if maxBytes is positive.
+func (logger *Logger) SetQueueBytes(maxBytes int64) {
+	if handler := logger.Handler(); handler != nil {
+		handler.SetQueueBytes(maxBytes)
+	}
+}
+
+// SetDropReport sets whether the handler created with the logger logs the
+// number of dropped records once its queue has space again.
+func (logger *Logger) SetDropReport(report bool) {
+	if handler := logger.Handler(); handler != nil {
+		handler.SetDropReport(report)
+	}
+}
+
+// SetExitFunc sets the function called by Fatal after the handlers are
+// closed. A nil function makes the logger use the one of its ancestors.
+func (logger *Logger) SetExitFunc(exit func(int)) {
+	logger.exitFunc = exit
+}
+
+// SetPropagate sets whether the records of logger are also written by its
+// ancestors.
+func (logger *Logger) SetPropagate(propagate bool) {
+	if propagate {
+		atomic.StoreInt32(&logger.propagate, 1)
+	} else {
+		atomic.StoreInt32(&logger.propagate, 0)
+	}
 }
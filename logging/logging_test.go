@@ -17,11 +17,197 @@
 package logging
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 )
 
+func TestHierarchy(t *testing.T) {
+	var root, db bytes.Buffer
+	logger, _ := WriterLogger("", WARNING, "%s %s %s:%d\n name,message,filename,lineno", DefaultTimeFormat, &root, true)
+	dbLogger := logger.GetChild("db")
+	pool := dbLogger.GetChild("pool")
+	if pool.Name() != "db.pool" || pool.Parent() != dbLogger {
+		t.Errorf("%v, %v\n", pool.Name(), pool.Parent())
+	}
+	pool.Info("hidden")
+	dbLogger.SetLevel(DEBUG)
+	if pool.EffectiveLevel() != DEBUG {
+		t.Errorf("%v, %v\n", pool.EffectiveLevel(), DEBUG)
+	}
+	pool.Info("shown")
+	logger.Info("hidden")
+	dbLogger.SetWriter(&db)
+	dbLogger.SetPropagate(false)
+	pool.Debug("db only")
+	expected := "db.pool shown logging_test.go:41\n"
+	if root.String() != expected {
+		t.Errorf("%q, %q\n", root.String(), expected)
+	}
+	expected = "db.pool db only logging_test.go:45\n"
+	if db.String() != expected {
+		t.Errorf("%q, %q\n", db.String(), expected)
+	}
+	logger.Destroy()
+}
+
+func TestHandlers(t *testing.T) {
+	var info, debug bytes.Buffer
+	logger, _ := WriterLogger("test", DEBUG, "[%s] %s\n levelname,message", DefaultTimeFormat, &info, true)
+	logger.Handler().SetLevel(INFO)
+	handler, _ := NewWriterHandler(DEBUG, "%s:%d %s\n funcname,seqid,message", DefaultTimeFormat, &debug, false)
+	logger.AddHandler(handler)
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Flush()
+	expected := "[INFO] info\n"
+	if info.String() != expected {
+		t.Errorf("%q, %q\n", info.String(), expected)
+	}
+	expected = "TestHandlers:1 debug\nTestHandlers:2 info\n"
+	if debug.String() != expected {
+		t.Errorf("%q, %q\n", debug.String(), expected)
+	}
+	logger.RemoveHandler(handler)
+	logger.Info("info")
+	logger.Destroy()
+	if debug.String() != expected {
+		t.Errorf("%q, %q\n", debug.String(), expected)
+	}
+	handler.Close()
+}
+
+func TestHandlersConcurrent(t *testing.T) {
+	logger, _ := WriterLogger("concurrent", DEBUG, "{message}", DefaultTimeFormat, ioutil.Discard, true)
+	defer logger.Destroy()
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			logger.Info("record")
+		}
+		done <- true
+	}()
+	for i := 0; i < 100; i++ {
+		handler, _ := NewWriterHandler(DEBUG, "{message}", DefaultTimeFormat, ioutil.Discard, true)
+		logger.AddHandler(handler)
+		handler.AddFilter(NameFilter("concurrent"))
+		logger.AddFilter(FilterFunc(func(r *Record) bool { return true }))
+		logger.RemoveHandler(handler)
+	}
+	<-done
+	if len(logger.Handlers()) != 1 || len(logger.Filters()) != 100 {
+		t.Errorf("%v, %v\n", len(logger.Handlers()), len(logger.Filters()))
+	}
+}
+
+func TestFatal(t *testing.T) {
+	var buf bytes.Buffer
+	root, _ := WriterLogger("", DEBUG, "{levelname} {message}", DefaultTimeFormat, &buf, false)
+	code := 0
+	root.SetExitFunc(func(c int) { code = c })
+	child := root.GetChild("child")
+	child.Fatalf("fatal %d", 1)
+	if code != 1 || buf.String() != "CRITICAL fatal 1\n" {
+		t.Errorf("%v, %q\n", code, buf.String())
+	}
+	child.Error("after close")
+	if buf.String() != "CRITICAL fatal 1\n" {
+		t.Errorf("%q\n", buf.String())
+	}
+	root.Destroy()
+
+	buf.Reset()
+	logger, _ := WriterLogger("test", ERROR, "{levelname} {message}", DefaultTimeFormat, &buf, false)
+	defer func() {
+		if r := recover(); r != "panic 2" || buf.String() != "CRITICAL panic 2\n" {
+			t.Errorf("%v, %q\n", r, buf.String())
+		}
+		logger.Destroy()
+	}()
+	logger.Panicf("panic %d", 2)
+}
+
+func TestModuleLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := WriterLogger("test", WARNING, "{message}", DefaultTimeFormat, &buf, true)
+	if err := logger.SetModuleLevels("logging/logging_test=DEBUG,bad"); err == nil {
+		t.Errorf("%v\n", err)
+	}
+	logger.SetModuleLevels("funcname:TestModule*=ERROR,logging/logging_test.go=DEBUG")
+	child := logger.GetChild("child")
+	for i := 0; i < 2; i++ {
+		child.Warning("hidden")
+		child.Error("error")
+		func() {
+			child.Debug("debug")
+		}()
+	}
+	logger.SetModuleLevels("")
+	logger.Warning("warning")
+	expected := "error\ndebug\nerror\ndebug\nwarning\n"
+	if buf.String() != expected || logger.ModuleLevels() != "" {
+		t.Errorf("%q, %q\n", buf.String(), expected)
+	}
+	logger.Destroy()
+}
+
+func TestGetLogger(t *testing.T) {
+	pool := GetLogger("db.pool")
+	if GetLogger("db.pool") != pool || pool.Parent() != GetLogger("db") || GetLogger("db").Parent() != GetLogger("") {
+		t.Errorf("%v, %v\n", pool, pool.Parent())
+	}
+	logger, _ := BasicLogger("test")
+	found := 0
+	for _, l := range Loggers() {
+		if l == pool || l == logger || l == GetLogger("") {
+			found++
+		}
+	}
+	if found != 3 {
+		t.Errorf("%v, %v\n", found, 3)
+	}
+	FlushAll()
+	DestroyAll()
+	logger.Destroy()
+	if len(Loggers()) != 0 {
+		t.Errorf("%v, %v\n", len(Loggers()), 0)
+	}
+	if GetLogger("db.pool") == pool {
+		t.Errorf("%v, %v\n", GetLogger("db.pool"), pool)
+	}
+	DestroyAll()
+}
+
+func TestGetLoggerConcurrent(t *testing.T) {
+	DestroyAll()
+	loggers := make(chan *Logger)
+	for i := 0; i < 8; i++ {
+		go func() {
+			loggers <- GetLogger("")
+		}()
+	}
+	var root *Logger
+	for i := 0; i < 8; i++ {
+		select {
+		case l := <-loggers:
+			if root == nil {
+				root = l
+			} else if l != root {
+				t.Errorf("%v, %v\n", l, root)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v\n", "deadlock")
+		}
+	}
+	if len(Loggers()) != 1 {
+		t.Errorf("%v, %v\n", len(Loggers()), 1)
+	}
+	DestroyAll()
+}
+
 func BenchmarkSync(b *testing.B) {
 	logger, _ := RichLogger("main")
 	logger.SetLevel(NOTSET)
@@ -69,3 +255,86 @@ func BenchmarkPrintln(b *testing.B) {
 	}
 	out.Close()
 }
+
+func TestHandlerLogger(t *testing.T) {
+	if _, err := HandlerLogger("none", DEBUG); err == nil {
+		t.Errorf("%v\n", err)
+	}
+	handler, _ := NewWriterHandler(NOTSET, "{message}", DefaultTimeFormat, ioutil.Discard, true)
+	logger, err := HandlerLogger("handlers", DEBUG, handler)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer logger.Destroy()
+	if logger.Handler() != nil || len(logger.Handlers()) != 1 || logger.Handlers()[0] != handler {
+		t.Errorf("%v, %v\n", logger.Handler(), logger.Handlers())
+	}
+	if loggers := Loggers(); loggers[len(loggers)-1] != logger {
+		t.Errorf("%v\n", loggers)
+	}
+}
+
+func TestFlushClose(t *testing.T) {
+	finished := make(chan bool)
+	go func() {
+		for i := 0; i < 5000; i++ {
+			handler, _ := NewWriterHandler(NOTSET, BasicFormat, DefaultTimeFormat, ioutil.Discard, false)
+			start := make(chan bool)
+			flushed := make(chan bool)
+			go func() {
+				<-start
+				handler.Flush()
+				close(flushed)
+			}()
+			go func() {
+				<-start
+				handler.Close()
+			}()
+			close(start)
+			<-flushed
+			handler.Close()
+		}
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(20 * time.Second):
+		t.Fatalf("%v\n", "flush blocked by close")
+	}
+}
+
+func TestCustomizedLoggerQueue(t *testing.T) {
+	logger, err := CustomizedLogger("customized", DEBUG, BasicFormat, DefaultTimeFormat, ioutil.Discard, false, 5, 7, DefaultBufferSize, DefaultTimeInterval)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer logger.Destroy()
+	if logger.Handler().QueueSize() != 12 {
+		t.Errorf("%v\n", logger.Handler().QueueSize())
+	}
+	if _, err := CustomizedLogger("customized", DEBUG, BasicFormat, DefaultTimeFormat, ioutil.Discard, false, -1, 7, DefaultBufferSize, DefaultTimeInterval); err == nil {
+		t.Errorf("%v\n", err)
+	}
+}
+
+func TestSetWriterConcurrent(t *testing.T) {
+	root, _ := WriterLogger("setwriter", DEBUG, "{message}", DefaultTimeFormat, ioutil.Discard, true)
+	defer root.Destroy()
+	child := root.GetChild("child")
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			child.Info("record")
+			child.Writer()
+			child.Flush()
+		}
+		done <- true
+	}()
+	var buf bytes.Buffer
+	child.SetWriter(&buf)
+	<-done
+	child.Info("last")
+	if len(child.Handlers()) != 1 || child.Handler().Format() != "{message}" || !bytes.HasSuffix(buf.Bytes(), []byte("last\n")) {
+		t.Errorf("%v, %q\n", child.Handlers(), buf.String())
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"errors"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// moduleRule is a rule of SetModuleLevels, which sets the level of the records
+// logged from the files or functions matching the pattern.
+type moduleRule struct {
+	pattern  string // pattern of path.Match
+	function bool   // match the function name instead of the file
+	depth    int    // number of path components matched by a file pattern
+	level    Level  // level of the matched records
+}
+
+// moduleLevel is the level of a caller, if any rule matches it.
+type moduleLevel struct {
+	level Level
+	ok    bool
+}
+
+// moduleLevels holds the rules set by SetModuleLevels, and the results of the
+// rules cached by the program counters of callers.
+type moduleLevels struct {
+	spec  string
+	rules []moduleRule
+	lock  sync.RWMutex
+	cache map[uintptr]moduleLevel
+}
+
+// parseModuleLevels parses a comma separated list of pattern=level rules.
+func parseModuleLevels(spec string) (*moduleLevels, error) {
+	m := &moduleLevels{spec: spec, cache: make(map[uintptr]moduleLevel)}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, "=")
+		if i < 0 {
+			return nil, errors.New("logging module level error: " + item)
+		}
+		level, err := ParseLevel(item[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		rule := moduleRule{pattern: strings.TrimSpace(item[:i]), level: level}
+		if strings.HasPrefix(rule.pattern, "funcname:") {
+			rule.pattern = rule.pattern[len("funcname:"):]
+			rule.function = true
+		} else {
+			rule.depth = strings.Count(rule.pattern, "/") + 1
+		}
+		if _, err := path.Match(rule.pattern, ""); err != nil || rule.pattern == "" {
+			return nil, errors.New("logging module level error: " + item)
+		}
+		m.rules = append(m.rules, rule)
+	}
+	return m, nil
+}
+
+// lookup returns the level of the first rule matching the caller at pc.
+func (m *moduleLevels) lookup(pc uintptr) (Level, bool) {
+	m.lock.RLock()
+	l, ok := m.cache[pc]
+	m.lock.RUnlock()
+	if ok {
+		return l.level, l.ok
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	for _, rule := range m.rules {
+		if rule.match(frame.File, frame.Function) {
+			l = moduleLevel{rule.level, true}
+			break
+		}
+	}
+	m.lock.Lock()
+	m.cache[pc] = l
+	m.lock.Unlock()
+	return l.level, l.ok
+}
+
+// match reports whether the rule matches a caller.
+func (rule *moduleRule) match(file string, function string) bool {
+	name := getShortFuncName(function)
+	if !rule.function {
+		// the last depth components of the path
+		name = file
+		for i, n := len(file)-1, 0; i >= 0; i-- {
+			if file[i] == '/' {
+				if n++; n == rule.depth {
+					name = file[i+1:]
+					break
+				}
+			}
+		}
+		if !strings.HasSuffix(rule.pattern, ".go") {
+			name = strings.TrimSuffix(name, ".go")
+		}
+	}
+	ok, _ := path.Match(rule.pattern, name)
+	return ok
+}
+
+// moduleLevels returns the rules of logger or its nearest ancestor which has
+// rules set.
+func (logger *Logger) moduleLevels() *moduleLevels {
+	for l := logger; l != nil; l = l.parent {
+		if m, _ := l.modules.Load().(*moduleLevels); m != nil && len(m.rules) > 0 {
+			return m
+		}
+	}
+	return nil
+}
+
+// enabled reports whether a record with level is logged by logger. The level
+// set by SetModuleLevels for the caller takes precedence over the effective
+// level of the logger.
+func (logger *Logger) enabled(level Level) bool {
+	if m := logger.moduleLevels(); m != nil {
+		var pcs [1]uintptr
+		// Don't change the calldepth. The caller of the logging
+		// function is above runtime.Callers, enabled, log (or logf),
+		// and the logging function itself.
+		if runtime.Callers(4, pcs[:]) > 0 {
+			if l, ok := m.lookup(pcs[0]); ok {
+				return level >= l
+			}
+		}
+	}
+	return level >= logger.EffectiveLevel()
+}
+
+// SetModuleLevels sets the levels of the records by their callers, overriding
+// the level of the logger. The spec is a comma separated list of
+// pattern=level rules, where the first matching rule applies. A pattern of
+// path.Match is matched against the filename of the caller, or against as
+// many trailing components of its pathname as the pattern has if it contains
+// slashes, with the ".go" suffix optional. A pattern prefixed by "funcname:"
+// is matched against the function name of the caller. The rules apply to
+// the descendants of the logger which have no rules of their own, and an
+// empty spec removes them.
+//
+// Example:
+//
+//	logger.SetModuleLevels("db/*.go=DEBUG,handler.go=INFO,funcname:Auth=DEBUG")
+func (logger *Logger) SetModuleLevels(spec string) error {
+	m, err := parseModuleLevels(spec)
+	if err != nil {
+		return err
+	}
+	logger.modules.Store(m)
+	return nil
+}
+
+// ModuleLevels returns the spec set by SetModuleLevels.
+func (logger *Logger) ModuleLevels() string {
+	if m, _ := logger.modules.Load().(*moduleLevels); m != nil {
+		return m.spec
+	}
+	return ""
+}
@@ -0,0 +1,373 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// writeMsgpackValue writes a value in MessagePack. Values of other types than
+// nil, strings, bools, integers, floats, byte slices, errors and times are
+// written as strings by fmt.Sprint.
+func writeMsgpackValue(b *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		b.WriteByte(0xc0)
+	case string:
+		writeMsgpackString(b, v)
+	case bool:
+		if v {
+			b.WriteByte(0xc3)
+		} else {
+			b.WriteByte(0xc2)
+		}
+	case int:
+		writeMsgpackInt(b, int64(v))
+	case int8:
+		writeMsgpackInt(b, int64(v))
+	case int16:
+		writeMsgpackInt(b, int64(v))
+	case int32:
+		writeMsgpackInt(b, int64(v))
+	case int64:
+		writeMsgpackInt(b, v)
+	case uint:
+		writeMsgpackUint(b, uint64(v))
+	case uint8:
+		writeMsgpackUint(b, uint64(v))
+	case uint16:
+		writeMsgpackUint(b, uint64(v))
+	case uint32:
+		writeMsgpackUint(b, uint64(v))
+	case uint64:
+		writeMsgpackUint(b, v)
+	case float32:
+		b.WriteByte(0xca)
+		binary.Write(b, binary.BigEndian, math.Float32bits(v))
+	case float64:
+		b.WriteByte(0xcb)
+		binary.Write(b, binary.BigEndian, math.Float64bits(v))
+	case []byte:
+		writeMsgpackBin(b, v)
+	case time.Time:
+		writeMsgpackString(b, v.Format(time.RFC3339Nano))
+	case error:
+		writeMsgpackString(b, v.Error())
+	default:
+		writeMsgpackString(b, fmt.Sprint(v))
+	}
+}
+
+// writeMsgpackInt writes a signed integer in the smallest format.
+func writeMsgpackInt(b *bytes.Buffer, v int64) {
+	switch {
+	case v >= 0:
+		writeMsgpackUint(b, uint64(v))
+	case v >= -32:
+		b.WriteByte(byte(v))
+	case v >= math.MinInt8:
+		b.WriteByte(0xd0)
+		b.WriteByte(byte(v))
+	case v >= math.MinInt16:
+		b.WriteByte(0xd1)
+		binary.Write(b, binary.BigEndian, int16(v))
+	case v >= math.MinInt32:
+		b.WriteByte(0xd2)
+		binary.Write(b, binary.BigEndian, int32(v))
+	default:
+		b.WriteByte(0xd3)
+		binary.Write(b, binary.BigEndian, v)
+	}
+}
+
+// writeMsgpackUint writes an unsigned integer in the smallest format.
+func writeMsgpackUint(b *bytes.Buffer, v uint64) {
+	switch {
+	case v <= math.MaxInt8:
+		b.WriteByte(byte(v))
+	case v <= math.MaxUint8:
+		b.WriteByte(0xcc)
+		b.WriteByte(byte(v))
+	case v <= math.MaxUint16:
+		b.WriteByte(0xcd)
+		binary.Write(b, binary.BigEndian, uint16(v))
+	case v <= math.MaxUint32:
+		b.WriteByte(0xce)
+		binary.Write(b, binary.BigEndian, uint32(v))
+	default:
+		b.WriteByte(0xcf)
+		binary.Write(b, binary.BigEndian, v)
+	}
+}
+
+// writeMsgpackString writes a string.
+func writeMsgpackString(b *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		b.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		b.WriteByte(0xd9)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(0xda)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0xdb)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+	b.WriteString(s)
+}
+
+// writeMsgpackBin writes a byte slice as binary.
+func writeMsgpackBin(b *bytes.Buffer, p []byte) {
+	n := len(p)
+	switch {
+	case n <= math.MaxUint8:
+		b.WriteByte(0xc4)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(0xc5)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0xc6)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+	b.Write(p)
+}
+
+// writeMsgpackArray writes the header of an array of n elements.
+func writeMsgpackArray(b *bytes.Buffer, n int) {
+	switch {
+	case n < 16:
+		b.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(0xdc)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0xdd)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+}
+
+// writeMsgpackMap writes the header of a map of n pairs.
+func writeMsgpackMap(b *bytes.Buffer, n int) {
+	switch {
+	case n < 16:
+		b.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(0xde)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0xdf)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+}
+
+// writeMsgpackEventTime writes a time as the EventTime extension of Fluentd,
+// which is type 0 with 32-bit big endian seconds and nanoseconds.
+func writeMsgpackEventTime(b *bytes.Buffer, t time.Time) {
+	b.WriteByte(0xd7)
+	b.WriteByte(0)
+	binary.Write(b, binary.BigEndian, uint32(t.Unix()))
+	binary.Write(b, binary.BigEndian, uint32(t.Nanosecond()))
+}
+
+// msgpackExt is an extension value read by readMsgpack.
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// readMsgpack reads a value in MessagePack. Maps are read as
+// map[interface{}]interface{}, arrays as []interface{}, integers as int64 or
+// uint64, binaries as []byte and extensions as msgpackExt.
+func readMsgpack(r *bufio.Reader) (interface{}, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return readMsgpackMap(r, int(c&0x0f))
+	case c&0xf0 == 0x90:
+		return readMsgpackArray(r, int(c&0x0f))
+	case c&0xe0 == 0xa0:
+		p, err := readMsgpackBytes(r, int(c&0x1f))
+		return string(p), err
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readMsgpackLength(r, c-0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackBytes(r, n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := readMsgpackLength(r, c-0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackExt(r, n)
+	case 0xca:
+		var v uint32
+		err := binary.Read(r, binary.BigEndian, &v)
+		return float64(math.Float32frombits(v)), err
+	case 0xcb:
+		var v uint64
+		err := binary.Read(r, binary.BigEndian, &v)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		p, err := readMsgpackBytes(r, 1<<(c-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		var v uint64
+		for _, x := range p {
+			v = v<<8 | uint64(x)
+		}
+		return v, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		p, err := readMsgpackBytes(r, size)
+		if err != nil {
+			return nil, err
+		}
+		var v uint64
+		for _, x := range p {
+			v = v<<8 | uint64(x)
+		}
+		shift := uint(64 - 8*size)
+		return int64(v<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return readMsgpackExt(r, 1<<(c-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := readMsgpackLength(r, c-0xd9)
+		if err != nil {
+			return nil, err
+		}
+		p, err := readMsgpackBytes(r, n)
+		return string(p), err
+	case 0xdc, 0xdd:
+		n, err := readMsgpackLength(r, c-0xdc+1)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, n)
+	case 0xde, 0xdf:
+		n, err := readMsgpackLength(r, c-0xde+1)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, n)
+	}
+	return nil, fmt.Errorf("logging msgpack error: invalid byte 0x%02x", c)
+}
+
+// readMsgpackLength reads a big endian length of 1, 2 or 4 bytes for the
+// size class 0, 1 or 2.
+func readMsgpackLength(r *bufio.Reader, class byte) (int, error) {
+	p, err := readMsgpackBytes(r, 1<<class)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, x := range p {
+		n = n<<8 | int(x)
+	}
+	return n, nil
+}
+
+// readMsgpackBytes reads n bytes. The buffer grows as the bytes are read,
+// rather than being allocated by the length read, so that an invalid length
+// can't take more memory than the input.
+func readMsgpackBytes(r *bufio.Reader, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, errors.New("logging msgpack error: invalid length")
+	}
+	var b bytes.Buffer
+	if _, err := io.CopyN(&b, r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// readMsgpackExt reads the type and n bytes of data of an extension.
+func readMsgpackExt(r *bufio.Reader, n int) (interface{}, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	p, err := readMsgpackBytes(r, n)
+	return msgpackExt{Type: int8(t), Data: p}, err
+}
+
+// readMsgpackArray reads n elements of an array, which grows as they are
+// read.
+func readMsgpackArray(r *bufio.Reader, n int) (interface{}, error) {
+	a := []interface{}{}
+	for i := 0; i < n; i++ {
+		v, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+// readMsgpackMap reads n pairs of a map, which grows as they are read. Keys
+// of unhashable types are an error.
+func readMsgpackMap(r *bufio.Reader, n int) (interface{}, error) {
+	m := make(map[interface{}]interface{})
+	for i := 0; i < n; i++ {
+		k, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		switch k.(type) {
+		case []interface{}, map[interface{}]interface{}, []byte, msgpackExt:
+			return nil, errors.New("logging msgpack error: invalid map key")
+		}
+		m[k] = v
+	}
+	return m, nil
+}
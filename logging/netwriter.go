@@ -0,0 +1,257 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Framing is the way records are framed by a NetWriter.
+type Framing int
+
+// Values of framing
+const (
+	NewlineFraming Framing = iota // records terminated by newlines
+	LengthFraming                 // records prefixed by 32-bit big endian lengths
+	NullFraming                   // records terminated by null bytes, as GELF over TCP
+)
+
+// Defaults of NetWriter
+const (
+	DefaultNetTimeout = 5 * time.Second // default timeout of connecting and writing a record
+	DefaultNetBuffer  = 1 << 20         // default maximum bytes of buffered records
+)
+
+// NetWriter is a writer to a TCP, UDP or unix socket collector, which takes
+// each write as a record. A broken connection is reconnected with
+// exponential backoff, and records are buffered in memory up to a limit
+// while disconnected, dropping the oldest ones beyond it. Connecting and
+// writing each record are bounded by a timeout, so that a dead collector
+// never stalls the writing goroutine for long.
+type NetWriter struct {
+	network   string
+	addr      string
+	framing   Framing
+	timeout   time.Duration // timeout of connecting and writing a record
+	maxBuffer int           // maximum bytes of buffered records
+
+	lock       sync.Mutex
+	conn       net.Conn
+	buffer     [][]byte      // records buffered while disconnected
+	size       int           // bytes of buffered records
+	minBackoff time.Duration // first delay to reconnect
+	maxBackoff time.Duration // maximum delay to reconnect
+	backoff    time.Duration // current delay to reconnect
+	next       time.Time     // time of the next connecting attempt
+	closed     bool
+	dropped    uint64 // number of dropped records
+}
+
+// NewNetWriter creates a new writer to the collector at addr on the network,
+// which is "tcp", "udp", "unix" or another network of net.Dial. The timeout
+// bounds connecting and writing each record, and at most maxBuffer bytes of
+// records are buffered while disconnected. The writer connects on the first
+// record, and a failure is not reported but retried. A timeout or maxBuffer
+// which is not positive is replaced by DefaultNetTimeout or DefaultNetBuffer.
+func NewNetWriter(network string, addr string, framing Framing, timeout time.Duration, maxBuffer int) *NetWriter {
+	if timeout <= 0 {
+		timeout = DefaultNetTimeout
+	}
+	if maxBuffer <= 0 {
+		maxBuffer = DefaultNetBuffer
+	}
+	return &NetWriter{
+		network:    network,
+		addr:       addr,
+		framing:    framing,
+		timeout:    timeout,
+		maxBuffer:  maxBuffer,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 30 * time.Second,
+	}
+}
+
+// Write writes p as one record.
+func (w *NetWriter) Write(p []byte) (int, error) {
+	if err := w.WriteRecord(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteRecord writes a record, or buffers it if the collector is not
+// connected. It fails only if the writer is closed.
+func (w *NetWriter) WriteRecord(p []byte) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return errors.New("logging net error: closed")
+	}
+	w.push(w.frame(p))
+	w.send()
+	return nil
+}
+
+// frame returns a framed copy of the record.
+func (w *NetWriter) frame(p []byte) []byte {
+	switch w.framing {
+	case LengthFraming:
+		p = bytes.TrimSuffix(p, []byte{'\n'})
+		b := make([]byte, 4+len(p))
+		binary.BigEndian.PutUint32(b, uint32(len(p)))
+		copy(b[4:], p)
+		return b
+	case NullFraming:
+		p = bytes.TrimSuffix(p, []byte{'\n'})
+		b := make([]byte, len(p)+1)
+		copy(b, p)
+		return b
+	}
+	b := make([]byte, len(p), len(p)+1)
+	copy(b, p)
+	if len(b) == 0 || b[len(b)-1] != '\n' {
+		b = append(b, '\n')
+	}
+	return b
+}
+
+// push buffers a framed record, dropping the oldest ones over the limit but
+// never the new one, with the lock held.
+func (w *NetWriter) push(b []byte) {
+	w.buffer = append(w.buffer, b)
+	w.size += len(b)
+	for w.size > w.maxBuffer && len(w.buffer) > 1 {
+		w.size -= len(w.buffer[0])
+		w.buffer[0] = nil
+		w.buffer = w.buffer[1:]
+		atomic.AddUint64(&w.dropped, 1)
+	}
+}
+
+// send connects if needed and it is time to, and writes the buffered
+// records, with the lock held. A failed write closes the connection, and
+// the record is kept to be written after reconnecting.
+func (w *NetWriter) send() {
+	if w.conn == nil {
+		if time.Now().Before(w.next) {
+			return
+		}
+		conn, err := net.DialTimeout(w.network, w.addr, w.timeout)
+		if err != nil {
+			w.retry()
+			return
+		}
+		w.conn = conn
+		w.backoff = 0
+	}
+	for len(w.buffer) > 0 {
+		b := w.buffer[0]
+		w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+		if _, err := w.conn.Write(b); err != nil {
+			w.conn.Close()
+			w.conn = nil
+			w.retry()
+			return
+		}
+		w.size -= len(b)
+		w.buffer[0] = nil
+		w.buffer = w.buffer[1:]
+	}
+}
+
+// retry schedules the next connecting attempt with exponential backoff, with
+// the lock held.
+func (w *NetWriter) retry() {
+	if w.backoff == 0 {
+		w.backoff = w.minBackoff
+	} else if w.backoff *= 2; w.backoff > w.maxBackoff {
+		w.backoff = w.maxBackoff
+	}
+	w.next = time.Now().Add(w.backoff)
+}
+
+// Reopen closes the connection and reconnects now, writing the buffered
+// records.
+func (w *NetWriter) Reopen() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return nil
+	}
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	w.next = time.Time{}
+	w.send()
+	if w.conn == nil {
+		return errors.New("logging net error: cannot connect to " + w.addr)
+	}
+	return nil
+}
+
+// moved reports false, because there is no file to watch.
+func (w *NetWriter) moved() bool {
+	return false
+}
+
+// Close tries to write the buffered records, and closes the connection.
+func (w *NetWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.send()
+	w.closed = true
+	if w.conn != nil {
+		return w.conn.Close()
+	}
+	return nil
+}
+
+// Buffered returns the number of records buffered while disconnected.
+func (w *NetWriter) Buffered() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return len(w.buffer)
+}
+
+// Dropped returns the number of records dropped because the buffer is full.
+func (w *NetWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// SetBackoff sets the first and the maximum delays to reconnect, which are
+// 100ms and 30s by default.
+func (w *NetWriter) SetBackoff(min time.Duration, max time.Duration) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.minBackoff, w.maxBackoff = min, max
+}
+
+// NewNetHandler creates a new handler writing to a NetWriter, which is closed
+// when the handler is closed and reconnected by Reopen.
+func NewNetHandler(level Level, format string, timeFormat string, out *NetWriter, sync bool) (*WriterHandler, error) {
+	return newFileHandler(level, format, timeFormat, out, "", sync)
+}
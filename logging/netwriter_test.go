@@ -0,0 +1,137 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// readFrame reads a length-prefixed record.
+func readFrame(r io.Reader) string {
+	var size uint32
+	if binary.Read(r, binary.BigEndian, &size) != nil {
+		return ""
+	}
+	b := make([]byte, size)
+	io.ReadFull(r, b)
+	return string(b)
+}
+
+func TestNetWriter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	addr := ln.Addr().String()
+	w := NewNetWriter("tcp", addr, LengthFraming, time.Second, 64)
+	w.SetBackoff(time.Millisecond, 10*time.Millisecond)
+	handler, _ := NewNetHandler(NOTSET, "{levelname} {message}", DefaultTimeFormat, w, false)
+	logger, err := HandlerLogger("net", DEBUG, handler)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer logger.Destroy()
+
+	logger.Info("first")
+	logger.Info("second")
+	logger.Flush()
+	conn, _ := ln.Accept()
+	r := bufio.NewReader(conn)
+	for _, expected := range []string{"INFO first", "INFO second"} {
+		if s := readFrame(r); s != expected {
+			t.Errorf("%q, %q\n", s, expected)
+		}
+	}
+	conn.Close()
+	ln.Close()
+
+	// Reconnecting to the closed listener fails, so records are buffered.
+	if err := w.Reopen(); err == nil {
+		t.Errorf("%v\n", err)
+	}
+	for i := 0; i < 10; i++ {
+		logger.Info("buffered")
+	}
+	logger.Flush()
+	if w.Buffered() == 0 || w.Dropped() == 0 {
+		t.Errorf("%v, %v\n", w.Buffered(), w.Dropped())
+	}
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer ln.Close()
+	if err := w.Reopen(); err != nil {
+		t.Errorf("%v\n", err)
+	}
+	logger.Warning("reconnected")
+	logger.Flush()
+	conn, _ = ln.Accept()
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r = bufio.NewReader(conn)
+	var last string
+	for s := readFrame(r); s != ""; s = readFrame(r) {
+		last = s
+		if s == "WARNING reconnected" {
+			break
+		}
+	}
+	if last != "WARNING reconnected" || w.Buffered() != 0 {
+		t.Errorf("%q, %v\n", last, w.Buffered())
+	}
+}
+
+func TestNetWriterDefaults(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer ln.Close()
+	w := NewNetWriter("tcp", ln.Addr().String(), NewlineFraming, 0, 0)
+	defer w.Close()
+	if w.timeout != DefaultNetTimeout || w.maxBuffer != DefaultNetBuffer {
+		t.Errorf("%v, %v\n", w.timeout, w.maxBuffer)
+	}
+	// A zero timeout would make the write deadline pass before writing, and
+	// a zero maxBuffer would keep only the last record.
+	for _, record := range []string{"first", "second"} {
+		if err := w.WriteRecord([]byte(record)); err != nil {
+			t.Errorf("%v\n", err)
+		}
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	for _, expected := range []string{"first\n", "second\n"} {
+		if s, _ := r.ReadString('\n'); s != expected {
+			t.Errorf("%q, %q\n", s, expected)
+		}
+	}
+	if w.Buffered() != 0 || w.Dropped() != 0 {
+		t.Errorf("%v, %v\n", w.Buffered(), w.Dropped())
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Overflow is the policy of an async handler when its queue is full.
+type Overflow int
+
+// Overflow policies
+const (
+	OverflowBlock        Overflow = iota // block the logging goroutine until the queue has space
+	OverflowBlockTimeout                 // block up to a timeout, and then drop the record
+	OverflowDropNewest                   // drop the record being logged
+	OverflowDropOldest                   // drop the oldest queued record
+	OverflowDropLowest                   // drop the oldest queued record of the lowest level, or the record being logged if it is lower
+)
+
+// recordOverhead is the estimated size in bytes of a queued record besides
+// its message and context.
+const recordOverhead = 288
+
+// dropLogger is the logger of the records reporting dropped records, which
+// are not logged by any logger of the program.
+var dropLogger = newLogger("logging", NOTSET, nil)
+
+// queued is a record in a queue with its estimated size.
+type queued struct {
+	record Record
+	size   int
+}
+
+// queue is the queue of records of an async handler, which is bounded by the
+// number of records, or by their estimated size in bytes if maxBytes is
+// positive, and handles the overflow by a policy.
+type queue struct {
+	lock     sync.Mutex
+	records  []queued
+	bytes    int           // estimated bytes of the queued records
+	size     int           // maximum number of records
+	maxBytes int64         // maximum bytes of records if positive, accessed atomically
+	overflow Overflow      // policy when the queue is full
+	timeout  time.Duration // timeout of OverflowBlockTimeout
+	report   bool          // pop a record of the number of dropped records once there is space
+	dropped  uint64        // number of dropped records, accessed atomically
+	pending  int           // number of dropped records not reported yet
+	waiters  int           // number of goroutines blocked on space
+	space    chan bool     // closed when records are popped if there are waiters
+	ready    chan bool     // signaled while there are queued records
+}
+
+// newQueue creates a queue of at most size records.
+func newQueue(size int) *queue {
+	return &queue{size: size, space: make(chan bool), ready: make(chan bool, 1)}
+}
+
+// push queues a copy of the record if there is space, or else handles the
+// overflow by the policy. Blocking for space returns without queuing the
+// record once done is closed.
+func (q *queue) push(r *Record, done <-chan bool) {
+	size := recordOverhead + 16*len(r.context)
+	if atomic.LoadInt64(&q.maxBytes) > 0 {
+		// The message is generated here, rather than by the watcher,
+		// to know the size of the record.
+		r.genMessage()
+		size += len(r.message)
+	}
+	var timeout <-chan time.Time
+	q.lock.Lock()
+	for !q.fits(1, size) {
+		switch q.overflow {
+		case OverflowDropNewest:
+			q.drop()
+			q.lock.Unlock()
+			return
+		case OverflowDropOldest:
+			q.remove(0)
+			q.drop()
+		case OverflowDropLowest:
+			i := q.lowest(r.level)
+			if i < 0 {
+				q.drop()
+				q.lock.Unlock()
+				return
+			}
+			q.remove(i)
+			q.drop()
+		default:
+			if q.overflow == OverflowBlockTimeout && timeout == nil {
+				timeout = time.After(q.timeout)
+			}
+			space := q.space
+			q.waiters++
+			q.lock.Unlock()
+			select {
+			case <-space:
+			case <-timeout:
+				q.lock.Lock()
+				q.waiters--
+				q.drop()
+				q.lock.Unlock()
+				return
+			case <-done:
+				q.lock.Lock()
+				q.waiters--
+				q.lock.Unlock()
+				return
+			}
+			q.lock.Lock()
+			q.waiters--
+		}
+	}
+	q.records = append(q.records, queued{*r, size})
+	q.bytes += size
+	q.lock.Unlock()
+	q.signal()
+}
+
+// pop removes and returns the oldest record, and reports whether there is
+// one. If records are dropped and the queue has space again, a WARNING record
+// of their number is returned first when reporting is enabled.
+func (q *queue) pop() (Record, bool) {
+	q.lock.Lock()
+	var r Record
+	if q.reporting() && q.fits(1, recordOverhead) {
+		r = Record{level: WARNING, format: "%d records dropped", args: []interface{}{q.pending}}
+		r.genNonRuntime(dropLogger)
+		q.pending = 0
+	} else if len(q.records) > 0 {
+		r = q.records[0].record
+		q.remove(0)
+	} else {
+		q.lock.Unlock()
+		return Record{}, false
+	}
+	more := len(q.records) > 0 || q.reporting()
+	q.lock.Unlock()
+	if more {
+		q.signal()
+	}
+	return r, true
+}
+
+// reporting reports whether there are dropped records to report. It must be
+// called with the lock held.
+func (q *queue) reporting() bool {
+	return q.report && q.pending > 0
+}
+
+// signal signals that there are queued records without blocking.
+func (q *queue) signal() {
+	select {
+	case q.ready <- true:
+	default:
+	}
+}
+
+// fits reports whether n more records of size bytes fit in the queue. A
+// record always fits in an empty queue.
+func (q *queue) fits(n int, size int) bool {
+	if len(q.records) == 0 {
+		return true
+	}
+	if maxBytes := atomic.LoadInt64(&q.maxBytes); maxBytes > 0 {
+		return int64(q.bytes+size) <= maxBytes
+	}
+	return len(q.records)+n <= q.size
+}
+
+// remove removes the i-th record, and wakes the goroutines blocked on space.
+// It must be called with the lock held.
+func (q *queue) remove(i int) {
+	q.bytes -= q.records[i].size
+	if i == 0 {
+		q.records[0] = queued{}
+		q.records = q.records[1:]
+	} else {
+		copy(q.records[i:], q.records[i+1:])
+		q.records[len(q.records)-1] = queued{}
+		q.records = q.records[:len(q.records)-1]
+	}
+	if q.waiters > 0 {
+		close(q.space)
+		q.space = make(chan bool)
+	}
+}
+
+// lowest returns the index of the oldest queued record of the lowest level,
+// or -1 if no queued record is lower than level.
+func (q *queue) lowest(level Level) int {
+	index := -1
+	for i := range q.records {
+		if l := q.records[i].record.level; l < level {
+			index, level = i, l
+		}
+	}
+	return index
+}
+
+// drop counts a dropped record. It must be called with the lock held.
+func (q *queue) drop() {
+	atomic.AddUint64(&q.dropped, 1)
+	q.pending++
+}
+
+// len returns the number of queued records, including the record reporting
+// dropped records if there is one to pop.
+func (q *queue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.reporting() {
+		return len(q.records) + 1
+	}
+	return len(q.records)
+}
+
+// parseOverflow parses an overflow policy, which is "block", "timeout",
+// "newest", "oldest" or "lowest".
+func parseOverflow(s string) (Overflow, error) {
+	switch strings.ToLower(s) {
+	case "", "block":
+		return OverflowBlock, nil
+	case "timeout":
+		return OverflowBlockTimeout, nil
+	case "newest":
+		return OverflowDropNewest, nil
+	case "oldest":
+		return OverflowDropOldest, nil
+	case "lowest":
+		return OverflowDropLowest, nil
+	}
+	return OverflowBlock, errors.New("logging overflow error: " + s)
+}
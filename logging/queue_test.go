@@ -0,0 +1,182 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func queueRecord(logger *Logger, level Level, message string) *Record {
+	r := &Record{level: level, args: []interface{}{message}}
+	r.genNonRuntime(logger)
+	return r
+}
+
+func queueMessages(q *queue) string {
+	var s string
+	for {
+		r, ok := q.pop()
+		if !ok {
+			return s
+		}
+		s += r.Message() + ";"
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	logger := newLogger("queue", NOTSET, nil)
+	tests := []struct {
+		overflow Overflow
+		levels   []Level
+		want     string
+		dropped  uint64
+	}{
+		{OverflowDropNewest, []Level{INFO, INFO, INFO}, "0;1;", 1},
+		{OverflowDropOldest, []Level{INFO, INFO, INFO}, "1;2;", 1},
+		{OverflowDropLowest, []Level{INFO, DEBUG, ERROR, DEBUG}, "0;2;", 2},
+		{OverflowBlockTimeout, []Level{INFO, INFO, INFO}, "0;1;", 1},
+	}
+	for _, test := range tests {
+		q := newQueue(2)
+		q.overflow = test.overflow
+		q.timeout = 10 * time.Millisecond
+		for i, level := range test.levels {
+			q.push(queueRecord(logger, level, string(rune('0'+i))), nil)
+		}
+		if got := queueMessages(q); got != test.want || q.dropped != test.dropped {
+			t.Errorf("%v %q %v\n", test.overflow, got, q.dropped)
+		}
+	}
+}
+
+func TestQueueBlock(t *testing.T) {
+	logger := newLogger("queue", NOTSET, nil)
+	q := newQueue(1)
+	q.push(queueRecord(logger, INFO, "0"), nil)
+	pushed := make(chan bool)
+	go func() {
+		q.push(queueRecord(logger, INFO, "1"), nil)
+		pushed <- true
+	}()
+	select {
+	case <-pushed:
+		t.Errorf("%v\n", "not blocked")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if r, ok := q.pop(); !ok || r.Message() != "0" {
+		t.Errorf("%v\n", r.Message())
+	}
+	<-pushed
+	done := make(chan bool)
+	go func() {
+		q.push(queueRecord(logger, INFO, "2"), done)
+		pushed <- true
+	}()
+	close(done)
+	<-pushed
+	if got := queueMessages(q); got != "1;" || q.dropped != 0 {
+		t.Errorf("%q %v\n", got, q.dropped)
+	}
+}
+
+func TestQueueBytes(t *testing.T) {
+	logger := newLogger("queue", NOTSET, nil)
+	q := newQueue(100)
+	q.overflow = OverflowDropNewest
+	q.maxBytes = 2*recordOverhead + 10
+	q.report = true
+	for _, message := range []string{"aaaaa", "bbbbb", "ccccc", "ddddd"} {
+		q.push(queueRecord(logger, INFO, message), nil)
+	}
+	// the report to pop is counted by len
+	if q.len() != 3 || q.bytes != 2*recordOverhead+10 || q.dropped != 2 {
+		t.Errorf("%v %v %v\n", q.len(), q.bytes, q.dropped)
+	}
+	q.pop()
+	q.push(queueRecord(logger, INFO, "e"), nil)
+	if r, _ := q.pop(); r.Message() != "bbbbb" {
+		t.Errorf("%q\n", r.Message())
+	}
+	// the report is popped once a record fits again
+	r, _ := q.pop()
+	if r.Message() != "2 records dropped" || r.Level() != WARNING || r.Name() != "logging" || queueMessages(q) != "e;" || q.bytes != 0 {
+		t.Errorf("%q\n", r.Message())
+	}
+}
+
+func TestDropReport(t *testing.T) {
+	var out bytes.Buffer
+	logger, _ := WriterLogger("drop", DEBUG, "{levelname} {message}", DefaultTimeFormat, &out, false)
+	defer logger.Destroy()
+	logger.SetOverflow(OverflowDropNewest, 0)
+	logger.SetDropReport(true)
+	logger.handler.queue.size = 1
+	logger.handler.queue.lock.Lock()
+	logger.handler.queue.records = append(logger.handler.queue.records, queued{*queueRecord(logger, INFO, "first"), recordOverhead})
+	logger.handler.queue.lock.Unlock()
+	logger.Info("dropped")
+	logger.Flush()
+	logger.Info("last")
+	logger.Flush()
+	if out.String() != "INFO first\nWARNING 1 records dropped\nINFO last\n" || logger.Dropped() != 1 {
+		t.Errorf("%q %v\n", out.String(), logger.Dropped())
+	}
+}
+
+func TestDropReportIdle(t *testing.T) {
+	var out bytes.Buffer
+	logger, _ := WriterLogger("idle", DEBUG, "{name} {levelname} {message}", DefaultTimeFormat, &out, false)
+	logger.SetOverflow(OverflowDropNewest, 0)
+	logger.SetDropReport(true)
+	logger.handler.queue.size = 1
+	logger.handler.queue.lock.Lock()
+	logger.handler.queue.records = append(logger.handler.queue.records, queued{*queueRecord(logger, INFO, "first"), recordOverhead})
+	logger.handler.queue.lock.Unlock()
+	// a burst without records logged after it is reported on closing
+	for i := 0; i < 3; i++ {
+		logger.Info("dropped")
+	}
+	logger.Destroy()
+	if out.String() != "idle INFO first\nlogging WARNING 3 records dropped\n" {
+		t.Errorf("%q\n", out.String())
+	}
+}
+
+func TestQueueConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "queue")
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "logging.conf")
+	ioutil.WriteFile(conf, []byte("name = conf\noverflow = timeout\noverflowTimeout = 100ms\nqueueBytes = 1M\ndropReport = 1\nfile = "+filepath.Join(dir, "conf.log")+"\n"), 0644)
+	logger, err := ConfigLogger(conf)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer logger.Destroy()
+	q := logger.Handler().queue
+	if q.overflow != OverflowBlockTimeout || q.timeout != 100*time.Millisecond || q.maxBytes != 1<<20 || !q.report {
+		t.Errorf("%v %v %v %v\n", q.overflow, q.timeout, q.maxBytes, q.report)
+	}
+	ioutil.WriteFile(conf, []byte("overflow = never\n"), 0644)
+	if _, err := ConfigLogger(conf); err == nil {
+		t.Errorf("%v\n", err)
+	}
+}
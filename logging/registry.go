@@ -0,0 +1,124 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"strings"
+	"sync"
+)
+
+// registry keeps track of the loggers, so that they can be found by name and
+// flushed or destroyed together.
+var registry = struct {
+	sync.Mutex
+	loggers []*Logger          // loggers in creation order
+	names   map[string]*Logger // loggers created by GetLogger
+}{names: make(map[string]*Logger)}
+
+// register adds logger to the registry.
+func register(logger *Logger) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.loggers = append(registry.loggers, logger)
+}
+
+// unregister removes logger, and the loggers derived from it by With, from
+// the registry.
+func unregister(logger *Logger) {
+	registry.Lock()
+	defer registry.Unlock()
+	for i, l := range registry.loggers {
+		if l.core == logger.core {
+			registry.loggers = append(registry.loggers[:i], registry.loggers[i+1:]...)
+			break
+		}
+	}
+	for name, l := range registry.names {
+		if l.core == logger.core {
+			delete(registry.names, name)
+		}
+	}
+}
+
+// GetLogger returns the logger with the name, creating it on first use, so all
+// the calls with the same name return the same logger. The logger named ""
+// is the root, which is created by SimpleLogger. Any other name is split by
+// dots, and the logger is created by GetChild from the logger of its parent
+// name, e.g. "db.pool" is a child of "db", which is a child of the root.
+func GetLogger(name string) *Logger {
+	registry.Lock()
+	logger, ok := registry.names[name]
+	registry.Unlock()
+	if ok {
+		return logger
+	}
+	if name == "" {
+		logger, _ = SimpleLogger("")
+	} else {
+		parent := ""
+		suffix := name
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			parent = name[:i]
+			suffix = name[i+1:]
+		}
+		logger = GetLogger(parent).GetChild(suffix)
+	}
+	registry.Lock()
+	if l, ok := registry.names[name]; ok {
+		registry.Unlock()
+		// created by another goroutine in the meantime, and the root
+		// created here is destroyed after unlocking, because Destroy
+		// locks the registry to unregister it
+		if name == "" {
+			logger.Destroy()
+		}
+		return l
+	}
+	if name != "" {
+		registry.loggers = append(registry.loggers, logger)
+	}
+	registry.names[name] = logger
+	registry.Unlock()
+	return logger
+}
+
+// Loggers returns the loggers that are created and not yet destroyed, in
+// creation order. Loggers created by GetChild are included only if they are
+// created through GetLogger.
+func Loggers() []*Logger {
+	registry.Lock()
+	defer registry.Unlock()
+	loggers := make([]*Logger, len(registry.loggers))
+	copy(loggers, registry.loggers)
+	return loggers
+}
+
+// FlushAll flushes all the loggers returned by Loggers.
+func FlushAll() {
+	for _, logger := range Loggers() {
+		logger.Flush()
+	}
+}
+
+// DestroyAll destroys all the loggers returned by Loggers, the latest created
+// first, so that children are destroyed before their parents.
+func DestroyAll() {
+	loggers := Loggers()
+	for i := len(loggers) - 1; i >= 0; i-- {
+		loggers[i].Destroy()
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"fmt"
+	"os"
+)
+
+// RotatingFileWriter is a writer to a file, which is rotated when it would
+// grow over a maximum size: logging.log is renamed to logging.log.1, which is
+// renamed to logging.log.2, and so on, keeping at most a maximum number of
+// backups. A file is rotated only before a write, so a write is never split
+// across files, and neither is a batch of records written by the watcher of
+// an async handler. A write larger than the maximum size goes to a file of
+// its own.
+type RotatingFileWriter struct {
+	appendFile
+	maxSize    int64 // maximum size of a file in bytes
+	maxBackups int   // maximum number of backups
+	size       int64 // size of the opened file
+}
+
+// NewRotatingFileWriter opens file for appending, to be rotated when it
+// would grow over maxSize bytes, keeping at most maxBackups backups.
+func NewRotatingFileWriter(file string, maxSize int64, maxBackups int) (*RotatingFileWriter, error) {
+	if maxSize <= 0 || maxBackups < 0 {
+		return nil, fmt.Errorf("logging rotation error: size %d, backups %d", maxSize, maxBackups)
+	}
+	fd, err := openFile(file)
+	if err != nil {
+		return nil, err
+	}
+	w := &RotatingFileWriter{appendFile: appendFile{name: file, fd: fd}, maxSize: maxSize, maxBackups: maxBackups}
+	w.size = w.fileSize()
+	return w, nil
+}
+
+func (w *RotatingFileWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.fd.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file now.
+func (w *RotatingFileWriter) Rotate() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.rotate()
+}
+
+// Reopen closes and reopens the file, e.g. after it is moved by logrotate.
+func (w *RotatingFileWriter) Reopen() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if err := w.reopen(); err != nil {
+		return err
+	}
+	w.size = w.fileSize()
+	return nil
+}
+
+// rotate renames the backups and the file with the lock held, and opens a
+// new file.
+func (w *RotatingFileWriter) rotate() error {
+	if w.closed {
+		return nil
+	}
+	if w.maxBackups == 0 {
+		os.Remove(w.name)
+	} else {
+		ext := w.ext()
+		os.Remove(w.backup(w.maxBackups))
+		if ext != "" {
+			os.Remove(w.backup(w.maxBackups) + ext)
+		}
+		for i := w.maxBackups - 1; i > 0; i-- {
+			os.Rename(w.backup(i), w.backup(i+1))
+			if ext != "" {
+				os.Rename(w.backup(i)+ext, w.backup(i+1)+ext)
+			}
+		}
+		if err := os.Rename(w.name, w.backup(1)); err != nil {
+			return err
+		}
+	}
+	if err := w.reopen(); err != nil {
+		return err
+	}
+	w.size = w.fileSize()
+	w.archived()
+	return nil
+}
+
+// SetRetention sets the compression and pruning of the backups. The number
+// of backups is limited by maxBackups in addition.
+func (w *RotatingFileWriter) SetRetention(retention Retention) error {
+	return w.retain(retention, w.backups)
+}
+
+// backups returns the existing backups, compressed or not, oldest first.
+func (w *RotatingFileWriter) backups() []string {
+	ext := w.ext()
+	var names []string
+	for i := w.maxBackups; i > 0; i-- {
+		name := w.backup(i)
+		if _, err := os.Stat(name); err == nil {
+			names = append(names, name)
+		}
+		if _, err := os.Stat(name + ext); ext != "" && err == nil {
+			names = append(names, name+ext)
+		}
+	}
+	return names
+}
+
+// backup returns the name of the ith backup.
+func (w *RotatingFileWriter) backup(i int) string {
+	return fmt.Sprintf("%s.%d", w.name, i)
+}
+
+// fileSize returns the size of the opened file.
+func (w *RotatingFileWriter) fileSize() int64 {
+	info, err := w.fd.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// NewRotatingFileHandler creates a new handler with file output, which is
+// rotated by a RotatingFileWriter.
+func NewRotatingFileHandler(level Level, format string, timeFormat string, file string, sync bool, maxSize int64, maxBackups int) (*WriterHandler, error) {
+	out, err := NewRotatingFileWriter(file, maxSize, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return newFileHandler(level, format, timeFormat, out, file, sync)
+}
@@ -0,0 +1,80 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFileWriter(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logging")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "logging.log")
+	w, err := NewRotatingFileWriter(file, 14, 2)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+	w.Write([]byte("a long line over the size\n"))
+	w.Close()
+	expected := map[string]string{
+		file:        "a long line over the size\n",
+		file + ".1": "line 4\n",
+		file + ".2": "line 2\nline 3\n",
+		file + ".3": "",
+	}
+	for name, content := range expected {
+		data, _ := ioutil.ReadFile(name)
+		if string(data) != content {
+			t.Errorf("%s: %q, %q\n", name, data, content)
+		}
+	}
+
+	conf := filepath.Join(dir, "logging.conf")
+	file = filepath.Join(dir, "conf.log")
+	ioutil.WriteFile(conf, []byte("name = conf\nsync = 0\nformat = {message}\nmaxSize = 1K\nmaxBackups = 3\nfile = "+file+"\n"), 0644)
+	logger, err := ConfigLogger(conf)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	for i := 0; i < 100; i++ {
+		logger.Infof("record %02d of a batch", i)
+	}
+	logger.Destroy()
+	var all []string
+	for i := 3; i >= 0; i-- {
+		name := file
+		if i > 0 {
+			name = fmt.Sprintf("%s.%d", file, i)
+		}
+		data, _ := ioutil.ReadFile(name)
+		if len(data) > 0 && (!strings.HasPrefix(string(data), "record") || data[len(data)-1] != '\n') {
+			t.Errorf("%s: %q\n", name, data)
+		}
+		all = append(all, string(data))
+	}
+	if s := strings.Join(all, ""); !strings.HasSuffix(s, "record 99 of a batch\n") {
+		t.Errorf("%q\n", s)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+)
+
+// signals keeps the state of HandleSignals.
+var signals = struct {
+	sync.Mutex
+	c      chan os.Signal
+	levels map[*core]Level // levels before the first CycleLevels
+}{levels: make(map[*core]Level)}
+
+// HandleSignals makes the loggers returned by Loggers handle signals: SIGHUP
+// reopens their files by ReopenAll, SIGUSR1 cycles their levels by
+// CycleLevels, and SIGUSR2 restores their levels by RestoreLevels. It does
+// nothing on systems without these signals.
+func HandleSignals() {
+	signals.Lock()
+	defer signals.Unlock()
+	if signals.c != nil || reopenSignal == nil {
+		return
+	}
+	c := make(chan os.Signal, 1)
+	signals.c = c
+	signal.Notify(c, reopenSignal, cycleSignal, restoreSignal)
+	go func() {
+		for sig := range c {
+			switch sig {
+			case reopenSignal:
+				ReopenAll()
+			case cycleSignal:
+				CycleLevels()
+			case restoreSignal:
+				RestoreLevels()
+			}
+		}
+	}()
+}
+
+// StopSignals undoes HandleSignals.
+func StopSignals() {
+	signals.Lock()
+	defer signals.Unlock()
+	if signals.c != nil {
+		signal.Stop(signals.c)
+		close(signals.c)
+		signals.c = nil
+	}
+}
+
+// CycleLevels sets the level of each logger returned by Loggers, except the
+// ones with level NOTSET, to the next more verbose named level, e.g. from
+// WARNING to INFO, and from the most verbose one back to CRITICAL. The
+// levels before the first call are kept for RestoreLevels.
+func CycleLevels() {
+	signals.Lock()
+	defer signals.Unlock()
+	for _, logger := range Loggers() {
+		level := logger.Level()
+		if level == NOTSET {
+			continue
+		}
+		if _, ok := signals.levels[logger.core]; !ok {
+			signals.levels[logger.core] = level
+		}
+		logger.SetLevel(nextLevel(level))
+	}
+}
+
+// RestoreLevels restores the levels changed by CycleLevels.
+func RestoreLevels() {
+	signals.Lock()
+	defer signals.Unlock()
+	for _, logger := range Loggers() {
+		if level, ok := signals.levels[logger.core]; ok {
+			logger.SetLevel(level)
+		}
+	}
+	signals.levels = make(map[*core]Level)
+}
+
+// nextLevel returns the highest named level lower than level, or the highest
+// named level if there is none.
+func nextLevel(level Level) Level {
+	levelsLock.RLock()
+	var levels []int
+	for l := range levelNames {
+		if l > NOTSET {
+			levels = append(levels, int(l))
+		}
+	}
+	levelsLock.RUnlock()
+	sort.Sort(sort.Reverse(sort.IntSlice(levels)))
+	for _, l := range levels {
+		if Level(l) < level {
+			return Level(l)
+		}
+	}
+	return Level(levels[0])
+}
@@ -14,11 +14,18 @@
 //
 // author: Cong Ding <dinggnu@gmail.com>
 
+//go:build windows || plan9
+// +build windows plan9
+
 package logging
 
-// request struct stores the logger request
-type request struct {
-	level  Level
-	format string
-	v      []interface{}
-}
+import (
+	"os"
+)
+
+// The signals handled by HandleSignals, which are not available.
+var (
+	reopenSignal  os.Signal
+	cycleSignal   os.Signal
+	restoreSignal os.Signal
+)
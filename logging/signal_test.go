@@ -0,0 +1,84 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReopen(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logging")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "logging.log")
+	logger, err := FileLogger("reopen", DEBUG, "{message}", DefaultTimeFormat, file, false)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	logger.Info("before")
+	os.Rename(file, file+".1")
+	logger.Info("queued")
+	if err := ReopenAll(); err != nil {
+		t.Errorf("%v\n", err)
+	}
+	logger.Info("after")
+	logger.Flush()
+	old, _ := ioutil.ReadFile(file + ".1")
+	data, _ := ioutil.ReadFile(file)
+	if string(old)+string(data) != "before\nqueued\nafter\n" || string(data) == "" {
+		t.Errorf("%q, %q\n", old, data)
+	}
+
+	logger.Handler().Watch(10 * time.Millisecond)
+	os.Remove(file)
+	// the watcher creates the file again when it reopens it
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, err := os.Stat(file); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("not reopened\n")
+		}
+	}
+	logger.Info("watched")
+	logger.Destroy()
+	data, _ = ioutil.ReadFile(file)
+	if string(data) != "watched\n" {
+		t.Errorf("%q\n", data)
+	}
+}
+
+func TestCycleLevels(t *testing.T) {
+	logger, _ := WriterLogger("cycle", WARNING, BasicFormat, DefaultTimeFormat, ioutil.Discard, true)
+	defer logger.Destroy()
+	child := logger.GetChild("child")
+	CycleLevels()
+	if logger.Level() != INFO || child.Level() != NOTSET {
+		t.Errorf("%v, %v\n", logger.Level(), child.Level())
+	}
+	CycleLevels()
+	if logger.Level() != DEBUG {
+		t.Errorf("%v\n", logger.Level())
+	}
+	RestoreLevels()
+	if logger.Level() != WARNING {
+		t.Errorf("%v\n", logger.Level())
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package logging
+
+import (
+	"os"
+	"syscall"
+)
+
+// The signals handled by HandleSignals.
+var (
+	reopenSignal  os.Signal = syscall.SIGHUP
+	cycleSignal   os.Signal = syscall.SIGUSR1
+	restoreSignal os.Signal = syscall.SIGUSR2
+)
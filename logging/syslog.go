@@ -0,0 +1,373 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Facility is the facility of syslog messages.
+type Facility int
+
+// Values of facility
+const (
+	LOG_KERN Facility = iota
+	LOG_USER
+	LOG_MAIL
+	LOG_DAEMON
+	LOG_AUTH
+	LOG_SYSLOG
+	LOG_LPR
+	LOG_NEWS
+	LOG_UUCP
+	LOG_CRON
+	LOG_AUTHPRIV
+	LOG_FTP
+	_
+	_
+	_
+	_
+	LOG_LOCAL0
+	LOG_LOCAL1
+	LOG_LOCAL2
+	LOG_LOCAL3
+	LOG_LOCAL4
+	LOG_LOCAL5
+	LOG_LOCAL6
+	LOG_LOCAL7
+)
+
+// SyslogRFC is the format of syslog messages.
+type SyslogRFC int
+
+// Formats of syslog messages
+const (
+	RFC5424 SyslogRFC = iota
+	RFC3164
+)
+
+// The sockets of the local syslog daemon
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// SyslogHandler is a handler that writes records to a syslog daemon, in the
+// format of RFC 5424 or RFC 3164, through UDP, TCP, TLS or a unix socket.
+// Records are written in the calling goroutine, with connecting and writing
+// each record bounded by a timeout, so that a stalled daemon never blocks the
+// logging goroutines for long. A broken connection is reconnected on the next
+// record, and after a failed reconnection records are dropped for a delay,
+// which doubles on each failure up to a minute.
+type SyslogHandler struct {
+	level      Level    // record level higher than this will be written
+	filterList          // filters to check records
+	facility   Facility // facility of the messages
+	appName    string   // app name, or the logger name if ""
+	rfc        SyslogRFC
+	sdID       string // SD-ID of the context fields in RFC 5424
+
+	network   string      // network, or "" for the local daemon
+	addr      string      // address of the daemon
+	tlsConfig *tls.Config // configuration of TLS, if network is "tls"
+	hostname  string
+	pid       string
+
+	lock    sync.Mutex
+	conn    net.Conn
+	stream  bool          // whether the connection is a stream
+	timeout time.Duration // timeout of connecting and writing a record
+	backoff time.Duration // current delay to reconnect
+	next    time.Time     // time of the next connecting attempt
+	closed  int32         // set when closed, to ignore records
+}
+
+// NewSyslogHandler creates a new handler writing to a syslog daemon, through
+// the network "udp", "tcp" or "unix", "unixgram", or "" for the local daemon
+// at /dev/log. The appName is the logger name if it is "". Messages are in
+// the format of RFC 5424, or RFC 3164 for the local daemon, which can be
+// changed by SetRFC.
+func NewSyslogHandler(level Level, network string, addr string, facility Facility, appName string) (*SyslogHandler, error) {
+	return newSyslogHandler(level, network, addr, nil, facility, appName)
+}
+
+// NewSyslogTLSHandler creates a new handler writing to a syslog daemon
+// through TLS, as in RFC 5425.
+func NewSyslogTLSHandler(level Level, addr string, config *tls.Config, facility Facility, appName string) (*SyslogHandler, error) {
+	return newSyslogHandler(level, "tls", addr, config, facility, appName)
+}
+
+// newSyslogHandler creates a new syslog handler and connects to the daemon.
+func newSyslogHandler(level Level, network string, addr string, config *tls.Config, facility Facility, appName string) (*SyslogHandler, error) {
+	if facility < LOG_KERN || facility > LOG_LOCAL7 {
+		return nil, fmt.Errorf("logging syslog error: facility %d", facility)
+	}
+	handler := &SyslogHandler{
+		level:     level,
+		facility:  facility,
+		appName:   appName,
+		sdID:      "ctx@32473",
+		network:   network,
+		addr:      addr,
+		tlsConfig: config,
+		hostname:  "-",
+		pid:       strconv.Itoa(os.Getpid()),
+		timeout:   DefaultNetTimeout,
+	}
+	if network == "" {
+		handler.rfc = RFC3164
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		handler.hostname = hostname
+	}
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	if err := handler.connect(); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+// connect connects to the daemon with the lock held.
+func (handler *SyslogHandler) connect() error {
+	if handler.conn != nil {
+		handler.conn.Close()
+		handler.conn = nil
+	}
+	var conn net.Conn
+	var err error
+	switch handler.network {
+	case "":
+		for _, addr := range syslogSockets {
+			for _, network := range []string{"unixgram", "unix"} {
+				if conn, err = net.DialTimeout(network, addr, handler.timeout); err == nil {
+					handler.conn = conn
+					handler.stream = network == "unix"
+					return nil
+				}
+			}
+		}
+		return errors.New("logging syslog error: no local daemon")
+	case "tls":
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: handler.timeout}, "tcp", handler.addr, handler.tlsConfig)
+	default:
+		conn, err = net.DialTimeout(handler.network, handler.addr, handler.timeout)
+	}
+	if err != nil {
+		return err
+	}
+	handler.conn = conn
+	handler.stream = handler.network == "tcp" || handler.network == "tls" || handler.network == "unix"
+	return nil
+}
+
+// Handle writes the record if its level is not lower than the level of the
+// handler and it passes all the filters of the handler.
+func (handler *SyslogHandler) Handle(r *Record) {
+	if r.level < handler.Level() || !handler.passes(r) || atomic.LoadInt32(&handler.closed) != 0 {
+		return
+	}
+	var b bytes.Buffer
+	handler.encode(&b, r)
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	if handler.write(b.Bytes()) == nil || time.Now().Before(handler.next) {
+		return
+	}
+	if err := handler.connect(); err != nil {
+		if handler.backoff == 0 {
+			handler.backoff = time.Second
+		} else if handler.backoff *= 2; handler.backoff > time.Minute {
+			handler.backoff = time.Minute
+		}
+		handler.next = time.Now().Add(handler.backoff)
+		return
+	}
+	handler.backoff = 0
+	handler.write(b.Bytes())
+}
+
+// write writes a message with the framing of the connection, with the lock
+// held. Messages on TCP and TLS are framed by octet counting, as in RFC 6587
+// and RFC 5425, and messages on unix streams are terminated by newlines.
+func (handler *SyslogHandler) write(msg []byte) error {
+	if handler.conn == nil {
+		return errors.New("logging syslog error: not connected")
+	}
+	handler.conn.SetWriteDeadline(time.Now().Add(handler.timeout))
+	var err error
+	switch {
+	case handler.network == "tcp" || handler.network == "tls":
+		_, err = handler.conn.Write(append([]byte(strconv.Itoa(len(msg))+" "), msg...))
+	case handler.stream:
+		_, err = handler.conn.Write(append(msg, '\n'))
+	default:
+		_, err = handler.conn.Write(msg)
+	}
+	return err
+}
+
+// encode writes the record as a syslog message.
+func (handler *SyslogHandler) encode(b *bytes.Buffer, r *Record) {
+	appName := handler.appName
+	if appName == "" {
+		appName = r.Name()
+	}
+	pri := int(handler.facility)*8 + SyslogSeverity(r.level)
+	if handler.rfc == RFC3164 {
+		fmt.Fprintf(b, "<%d>%s ", pri, r.Time().Format(time.Stamp))
+		if handler.network != "" {
+			b.WriteString(handler.hostname)
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(b, "%s[%s]: %s", syslogName(appName, 32), handler.pid, r.Message())
+		for i := 0; i+1 < len(r.context); i += 2 {
+			fmt.Fprint(b, " ", r.context[i], "=", r.context[i+1])
+		}
+		return
+	}
+	fmt.Fprintf(b, "<%d>1 %s %s %s %s - ", pri, r.Time().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogName(handler.hostname, 255), syslogName(appName, 48), handler.pid)
+	if len(r.context) < 2 {
+		b.WriteByte('-')
+	} else {
+		b.WriteByte('[')
+		b.WriteString(handler.sdID)
+		for i := 0; i+1 < len(r.context); i += 2 {
+			fmt.Fprintf(b, " %s=\"", syslogName(fmt.Sprint(r.context[i]), 32))
+			writeSDValue(b, fmt.Sprint(r.context[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte(']')
+	}
+	b.WriteByte(' ')
+	b.WriteString(r.Message())
+}
+
+// SyslogSeverity returns the syslog severity of a level: critical for
+// CRITICAL, error for ERROR, warning for WARNING, notice for the levels
+// between WARNING and INFO, info for INFO, and debug for lower levels.
+func SyslogSeverity(level Level) int {
+	switch {
+	case level >= CRITICAL:
+		return 2
+	case level >= ERROR:
+		return 3
+	case level >= WARNING:
+		return 4
+	case level > INFO:
+		return 5
+	case level == INFO:
+		return 6
+	}
+	return 7
+}
+
+// syslogName returns s with at most max printable ASCII characters other
+// than space, '=', ']' and '"', which are replaced by '_', or "-" if s is
+// empty.
+func syslogName(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	b := []byte(s)
+	if len(b) > max {
+		b = b[:max]
+	}
+	for i, c := range b {
+		if c <= ' ' || c >= 127 || c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// writeSDValue writes a PARAM-VALUE of structured data with '"', '\\' and
+// ']' escaped.
+func writeSDValue(b *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '"' || c == '\\' || c == ']' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+}
+
+// Runtime reports whether a filter has runtime fields.
+func (handler *SyslogHandler) Runtime() bool {
+	return handler.filtersRuntime()
+}
+
+// Flush does nothing, because records are written when handled.
+func (handler *SyslogHandler) Flush() {
+}
+
+// Close closes the connection to the daemon.
+func (handler *SyslogHandler) Close() {
+	atomic.StoreInt32(&handler.closed, 1)
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	if handler.conn != nil {
+		handler.conn.Close()
+		handler.conn = nil
+	}
+}
+
+// Getter functions
+
+func (handler *SyslogHandler) Level() Level {
+	return Level(atomic.LoadInt32((*int32)(&handler.level)))
+}
+
+func (handler *SyslogHandler) Facility() Facility {
+	return handler.facility
+}
+
+func (handler *SyslogHandler) RFC() SyslogRFC {
+	return handler.rfc
+}
+
+// Setter functions
+
+func (handler *SyslogHandler) SetLevel(level Level) {
+	atomic.StoreInt32((*int32)(&handler.level), int32(level))
+}
+
+// SetRFC sets the format of the messages.
+func (handler *SyslogHandler) SetRFC(rfc SyslogRFC) {
+	handler.rfc = rfc
+}
+
+// SetTimeout sets the timeout of connecting and writing a record, which is
+// DefaultNetTimeout by default.
+func (handler *SyslogHandler) SetTimeout(timeout time.Duration) {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	handler.timeout = timeout
+}
+
+// SetStructuredDataID sets the SD-ID of the context fields in RFC 5424, which
+// is ctx@32473 by default.
+func (handler *SyslogHandler) SetStructuredDataID(id string) {
+	handler.sdID = id
+}
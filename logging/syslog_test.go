@@ -0,0 +1,122 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogHandler(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer udp.Close()
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer tcp.Close()
+
+	logger, _ := WriterLogger("syslog", DEBUG, BasicFormat, DefaultTimeFormat, ioutil.Discard, true)
+	defer logger.Destroy()
+	handler, err := NewSyslogHandler(INFO, "udp", udp.LocalAddr().String(), LOG_LOCAL0, "")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	logger.AddHandler(handler)
+	logger.Debug("dropped")
+	logger.With("user", "a \"b\"]", "bad key", 1).Error("failed")
+	buf := make([]byte, 1024)
+	n, _, _ := udp.ReadFrom(buf)
+	expected := `^<131>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ \S+ syslog \d+ - \[ctx@32473 user="a \\"b\\"\\]" bad_key="1"\] failed$`
+	if !regexp.MustCompile(expected).Match(buf[:n]) {
+		t.Errorf("%q\n", buf[:n])
+	}
+	handler.SetRFC(RFC3164)
+	logger.Warning("warned")
+	n, _, _ = udp.ReadFrom(buf)
+	expected = `^<132>\w{3} [ \d]\d \d\d:\d\d:\d\d \S+ syslog\[\d+\]: warned$`
+	if !regexp.MustCompile(expected).Match(buf[:n]) {
+		t.Errorf("%q\n", buf[:n])
+	}
+	logger.RemoveHandler(handler)
+	handler.Close()
+
+	handler, err = NewSyslogHandler(DEBUG, "tcp", tcp.Addr().String(), LOG_USER, "app")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	conn, _ := tcp.Accept()
+	defer conn.Close()
+	logger.AddHandler(handler)
+	logger.Info("first")
+	logger.Info("second")
+	handler.Close()
+	r := bufio.NewReader(conn)
+	for _, message := range []string{"first", "second"} {
+		line, _ := r.ReadString(' ')
+		size, _ := strconv.Atoi(line[:len(line)-1])
+		data := make([]byte, size)
+		io.ReadFull(r, data)
+		expected = `^<14>1 \S+ \S+ app \d+ - - ` + message + `$`
+		if !regexp.MustCompile(expected).Match(data) {
+			t.Errorf("%q, %q\n", line, data)
+		}
+	}
+	if SyslogSeverity(5) != 7 || SyslogSeverity(25) != 5 || SyslogSeverity(CRITICAL) != 2 {
+		t.Errorf("%v, %v\n", SyslogSeverity(5), SyslogSeverity(25))
+	}
+}
+
+func TestSyslogStalled(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer tcp.Close()
+	handler, err := NewSyslogHandler(DEBUG, "tcp", tcp.Addr().String(), LOG_USER, "app")
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	defer handler.Close()
+	handler.SetTimeout(50 * time.Millisecond)
+	logger, _ := WriterLogger("stalled", DEBUG, BasicFormat, DefaultTimeFormat, ioutil.Discard, true)
+	defer logger.Destroy()
+	logger.AddHandler(handler)
+	message := strings.Repeat("x", 1<<20)
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 30; i++ {
+			logger.Info(message)
+		}
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%v\n", "blocked by a stalled daemon")
+	}
+}
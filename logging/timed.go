@@ -0,0 +1,285 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Period is the period of time-based rotation.
+type Period int
+
+// Periods of time-based rotation
+const (
+	Hourly Period = iota
+	Daily
+)
+
+// TimedFileWriter is a writer to files named by the time, which is rotated
+// at hourly or daily boundaries, e.g. from app-2016-01-02.log to
+// app-2016-01-03.log. The name pattern is either a strftime-like pattern if
+// it contains %, e.g. app-%Y-%m-%d.log, or a Go time layout, e.g.
+// app-2006-01-02.log, where only the base name is formatted and the directory
+// is used as is. A file is rotated only before a write, so a batch of
+// records written by the watcher of an async handler goes to the file of the
+// time of the write.
+type TimedFileWriter struct {
+	appendFile
+	pattern string         // pattern of the file names
+	period  Period         // period of the rotation
+	symlink string         // symlink to the current file, if not ""
+	loc     *time.Location // location of the boundaries
+	next    time.Time      // next boundary
+	now     func() time.Time
+}
+
+// NewTimedFileWriter opens the file of the current period for appending, to
+// be rotated every period in local time or in UTC. If symlink is not "", it is
+// kept as a symlink to the current file.
+func NewTimedFileWriter(pattern string, period Period, symlink string, utc bool) (*TimedFileWriter, error) {
+	return newTimedFileWriter(pattern, period, symlink, utc, time.Now)
+}
+
+// newTimedFileWriter creates a TimedFileWriter with a clock.
+func newTimedFileWriter(pattern string, period Period, symlink string, utc bool, now func() time.Time) (*TimedFileWriter, error) {
+	if period != Hourly && period != Daily {
+		return nil, fmt.Errorf("logging rotation error: period %d", period)
+	}
+	w := &TimedFileWriter{pattern: pattern, period: period, symlink: symlink, loc: time.Local, now: now}
+	if utc {
+		w.loc = time.UTC
+	}
+	if err := w.open(w.now()); err != nil {
+		return nil, err
+	}
+	if err := w.link(); err != nil {
+		w.fd.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *TimedFileWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if now := w.now(); !now.Before(w.next) && !w.closed {
+		old := w.fd
+		if err := w.open(now); err != nil {
+			return 0, err
+		}
+		old.Close()
+		w.link()
+		w.archived()
+	}
+	return w.fd.Write(p)
+}
+
+// Name returns the name of the current file.
+func (w *TimedFileWriter) Name() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.name
+}
+
+// open opens the file of the period of now with the lock held.
+func (w *TimedFileWriter) open(now time.Time) error {
+	start := w.start(now)
+	dir, base := filepath.Split(w.pattern)
+	name := dir + formatPattern(base, start)
+	fd, err := openFile(name)
+	if err != nil {
+		return err
+	}
+	w.name, w.fd = name, fd
+	if w.period == Hourly {
+		w.next = start.Add(time.Hour)
+	} else {
+		w.next = start.AddDate(0, 0, 1)
+	}
+	return nil
+}
+
+// start returns the start of the period of t.
+func (w *TimedFileWriter) start(t time.Time) time.Time {
+	t = t.In(w.loc)
+	hour := 0
+	if w.period == Hourly {
+		hour = t.Hour()
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, w.loc)
+}
+
+// link points the symlink, if any, to the current file by renaming a new
+// symlink over it.
+func (w *TimedFileWriter) link() error {
+	if w.symlink == "" {
+		return nil
+	}
+	target := w.name
+	if filepath.Dir(target) == filepath.Dir(w.symlink) {
+		target = filepath.Base(target)
+	}
+	tmp := w.symlink + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.symlink)
+}
+
+// SetRetention sets the compression and pruning of the files of the past
+// periods, which are the files in the directory of the pattern matching its
+// base name.
+func (w *TimedFileWriter) SetRetention(retention Retention) error {
+	return w.retain(retention, w.archives)
+}
+
+// archives returns the files of the past periods, compressed or not, oldest
+// first.
+func (w *TimedFileWriter) archives() []string {
+	dir, base := filepath.Split(w.pattern)
+	infos, err := ioutil.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	ext := w.ext()
+	var names []string
+	for _, info := range infos {
+		name := filepath.Join(dir, info.Name())
+		if !info.Mode().IsRegular() || name == filepath.Clean(w.name) {
+			continue
+		}
+		plain := info.Name()
+		if ext != "" {
+			plain = strings.TrimSuffix(plain, ext)
+		}
+		if matchPattern(base, plain) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// matchPattern reports whether name may be formatted from the pattern.
+func matchPattern(pattern string, name string) bool {
+	if !strings.Contains(pattern, "%") {
+		_, err := time.Parse(pattern, name)
+		return err == nil
+	}
+	var b strings.Builder
+	b.WriteByte('^')
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			b.WriteString(`\d{4}`)
+		case 'y', 'm', 'd', 'H', 'M', 'S':
+			b.WriteString(`\d{2}`)
+		case 'j':
+			b.WriteString(`\d{3}`)
+		case 'b', 'a':
+			b.WriteString(`[A-Za-z]{3}`)
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i-1 : i+1]))
+		}
+	}
+	b.WriteByte('$')
+	matched, _ := regexp.MatchString(b.String(), name)
+	return matched
+}
+
+// formatPattern formats the pattern of file names by t, as a strftime-like
+// pattern if it contains %, or as a Go time layout otherwise.
+func formatPattern(pattern string, t time.Time) string {
+	if !strings.Contains(pattern, "%") {
+		return t.Format(pattern)
+	}
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'y':
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'b':
+			b.WriteString(t.Format("Jan"))
+		case 'a':
+			b.WriteString(t.Format("Mon"))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+	return b.String()
+}
+
+// parsePeriod parses the period of time-based rotation, "hourly" or "daily".
+func parsePeriod(s string) (Period, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "hourly":
+		return Hourly, nil
+	case "daily":
+		return Daily, nil
+	}
+	return 0, errors.New("logging rotation error: " + s)
+}
+
+// NewTimedFileHandler creates a new handler with file output, which is
+// rotated by a TimedFileWriter.
+func NewTimedFileHandler(level Level, format string, timeFormat string, pattern string, sync bool, period Period, symlink string, utc bool) (*WriterHandler, error) {
+	out, err := NewTimedFileWriter(pattern, period, symlink, utc)
+	if err != nil {
+		return nil, err
+	}
+	return newFileHandler(level, format, timeFormat, out, pattern, sync)
+}
@@ -0,0 +1,69 @@
+// Copyright 2013, Cong Ding. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// author: Cong Ding <dinggnu@gmail.com>
+
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimedFileWriter(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logging")
+	defer os.RemoveAll(dir)
+	now := time.Date(2016, 1, 2, 23, 59, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	w, err := newTimedFileWriter(filepath.Join(dir, "app-%Y-%m-%d.log"), Daily, filepath.Join(dir, "current"), true, clock)
+	if err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	w.Write([]byte("first\n"))
+	now = now.Add(2 * time.Minute)
+	w.Write([]byte("second\n"))
+	w.Close()
+	expected := map[string]string{
+		"app-2016-01-02.log": "first\n",
+		"app-2016-01-03.log": "second\n",
+		"current":            "second\n",
+	}
+	for name, content := range expected {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		if string(data) != content {
+			t.Errorf("%s: %q, %q\n", name, data, content)
+		}
+	}
+	if target, _ := os.Readlink(filepath.Join(dir, "current")); target != "app-2016-01-03.log" {
+		t.Errorf("%v\n", target)
+	}
+
+	tests := map[string]string{
+		"app-2006-01-02T15.log": "app-2016-01-02T15.log",
+		"app1-%Y%m%d-%H.log":    "app1-20160102-15.log",
+		"%j-%b-%%-%q":           "002-Jan-%-%q",
+	}
+	for pattern, expected := range tests {
+		if name := formatPattern(pattern, time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)); name != expected {
+			t.Errorf("%v, %v\n", name, expected)
+		}
+	}
+	w2 := &TimedFileWriter{period: Hourly, loc: time.UTC}
+	if start := w2.start(time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)); !start.Equal(time.Date(2016, 1, 2, 15, 0, 0, 0, time.UTC)) {
+		t.Errorf("%v\n", start)
+	}
+}
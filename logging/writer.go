@@ -18,113 +18,214 @@ package logging
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"sync/atomic"
+	"runtime"
 	"time"
 )
 
-// watcher watches the logger.queue channel, and writes the logs to output
-func (logger *Logger) watcher() {
+// watcher watches the handler.queue, and writes the logs to output
+func (handler *WriterHandler) watcher() {
 	var buf bytes.Buffer
 	for {
-		timeout := time.After(time.Millisecond * logger.timeInterval)
+		timeout := time.After(time.Millisecond * handler.timeInterval)
 
-		for i := 0; i < logger.bufferSize; i++ {
+		for i := 0; i < handler.bufferSize; i++ {
 			select {
-			case msg := <-logger.queue:
-				fmt.Fprintln(&buf, msg)
-			case req := <-logger.request:
-				logger.flushReq(&buf, &req)
+			case <-handler.queue.ready:
+				if req, ok := handler.queue.pop(); ok {
+					handler.writeReq(&buf, &req)
+				}
 			case <-timeout:
-				i = logger.bufferSize
-			case <-logger.flush:
-				logger.flushBuf(&buf)
-				logger.finish <- true
-				i = logger.bufferSize
-			case <-logger.quit:
+				i = handler.bufferSize
+			case <-handler.flush:
+				// Records queued before the flush signal are
+				// written as well.
+				handler.drain(&buf)
+				handler.flushBuf(&buf)
+				handler.finish <- true
+				i = handler.bufferSize
+			case <-handler.quit:
 				// If quit signal received, cleans the channel
 				// and writes all of them to io.Writer.
-				for {
-					select {
-					case msg := <-logger.queue:
-						fmt.Fprintln(&buf, msg)
-					case req := <-logger.request:
-						logger.flushReq(&buf, &req)
-					case <-logger.flush:
-						// do nothing
-					default:
-						logger.flushBuf(&buf)
-						logger.quit <- true
-						return
-					}
-				}
+				handler.drain(&buf)
+				handler.flushBuf(&buf)
+				handler.quit <- true
+				return
 			}
 		}
-		logger.flushBuf(&buf)
+		handler.flushBuf(&buf)
+	}
+}
+
+// drain writes the requests queued when it is called to the buffer, so that
+// it returns even if records keep coming.
+func (handler *WriterHandler) drain(b *bytes.Buffer) {
+	for n := handler.queue.len(); n > 0; n-- {
+		req, ok := handler.queue.pop()
+		if !ok {
+			return
+		}
+		handler.writeReq(b, &req)
 	}
 }
 
 // flushBuf flushes the content of buffer to out and reset the buffer
-func (logger *Logger) flushBuf(b *bytes.Buffer) {
+func (handler *WriterHandler) flushBuf(b *bytes.Buffer) {
 	if len(b.Bytes()) > 0 {
-		logger.out.Write(b.Bytes())
+		handler.flushMsg(b.Bytes())
 		b.Reset()
 	}
 }
 
+// writeReq handles the request, and writes it at once to a RecordWriter, or
+// to the buffer to be written with others.
+func (handler *WriterHandler) writeReq(b *bytes.Buffer, req *Record) {
+	handler.flushReq(b, req)
+	if _, ok := handler.Writer().(RecordWriter); ok {
+		handler.flushBuf(b)
+	}
+}
+
 // flushReq handles the request and writes the result to writer
-func (logger *Logger) flushReq(b *bytes.Buffer, req *request) {
-	if req.format == "" {
-		msg := fmt.Sprint(req.v...)
-		msg = logger.genLog(req.level, msg)
-		fmt.Fprintln(b, msg)
+func (handler *WriterHandler) flushReq(b *bytes.Buffer, req *Record) {
+	req.timeFormat = handler.timeFormat
+	if handler.encoder != nil {
+		handler.encoder.Encode(b, req)
+		b.WriteByte('\n')
+	} else if layout := handler.getLayout(); layout.plan != nil {
+		genPlan(b, layout.plan, req)
+		b.WriteByte('\n')
 	} else {
-		msg := fmt.Sprintf(req.format, req.v...)
-		msg = logger.genLog(req.level, msg)
+		msg := layout.genLog(req)
 		fmt.Fprintln(b, msg)
 	}
 }
 
 // flushMsg is to print log to file, stdout, or others.
-func (logger *Logger) flushMsg(message string) {
-	if logger.sync {
-		logger.wlock.Lock()
-		defer logger.wlock.Unlock()
-		fmt.Fprintln(logger.out, message)
+func (handler *WriterHandler) flushMsg(message []byte) {
+	handler.wlock.Lock()
+	defer handler.wlock.Unlock()
+	if w, ok := handler.out.(RecordWriter); ok {
+		w.WriteRecord(message)
 	} else {
-		logger.queue <- message
+		handler.out.Write(message)
+	}
+}
+
+// needsRuntime reports whether a handler of logger uses runtime fields.
+func (logger *Logger) needsRuntime() bool {
+	for _, handler := range logger.Handlers() {
+		if handler.Runtime() {
+			return true
+		}
+	}
+	return false
+}
+
+// emit sends the record to the handlers of logger and, while the loggers
+// propagate, to the handlers of its ancestors, if it passes the filters of
+// logger.
+func (logger *Logger) emit(r *Record) {
+	r.genNonRuntime(logger)
+	if r.context == nil {
+		r.context = logger.context
+	}
+	for l := logger; l != nil; l = l.parent {
+		if l.needsRuntime() || (l == logger && l.filtersRuntime()) {
+			// Don't change the calldepth. The caller of the logging
+			// function is above emit, log (or logf), and the logging
+			// function itself.
+			r.pc, r.file, r.line, _ = runtime.Caller(3)
+			break
+		}
+		if !l.Propagate() {
+			break
+		}
+	}
+	if !logger.passes(r) {
+		return
+	}
+	for l := logger; l != nil; l = l.parent {
+		for _, handler := range l.Handlers() {
+			handler.Handle(r)
+		}
+		if !l.Propagate() {
+			break
+		}
 	}
 }
 
 // log records log v... with level `level'.
 func (logger *Logger) log(level Level, v ...interface{}) {
-	if int32(level) >= atomic.LoadInt32((*int32)(&logger.level)) {
-		if logger.runtime || logger.sync {
-			message := fmt.Sprint(v...)
-			message = logger.genLog(level, message)
-			logger.flushMsg(message)
-		} else {
-			r := new(request)
-			r.level = level
-			r.v = v
-			logger.request <- *r
-		}
+	if logger.enabled(level) {
+		r := new(Record)
+		r.level = level
+		r.args = v
+		logger.emit(r)
 	}
 }
 
 // logf records log v... with level `level'.
 func (logger *Logger) logf(level Level, format string, v ...interface{}) {
-	if int32(level) >= atomic.LoadInt32((*int32)(&logger.level)) {
-		if logger.runtime || logger.sync {
-			message := fmt.Sprintf(format, v...)
-			message = logger.genLog(level, message)
-			logger.flushMsg(message)
-		} else {
-			r := new(request)
-			r.level = level
-			r.format = format
-			r.v = v
-			logger.request <- *r
+	if logger.enabled(level) {
+		r := new(Record)
+		r.level = level
+		r.format = format
+		r.args = v
+		logger.emit(r)
+	}
+}
+
+// logCtx records log v... with level `level' and the key/value pairs
+// extracted from ctx.
+func (logger *Logger) logCtx(ctx context.Context, level Level, v ...interface{}) {
+	if logger.enabled(level) {
+		r := new(Record)
+		r.level = level
+		r.args = v
+		r.context = extractContext(logger.context, ctx)
+		logger.emit(r)
+	}
+}
+
+// logfCtx records log v... with level `level' and the key/value pairs
+// extracted from ctx.
+func (logger *Logger) logfCtx(ctx context.Context, level Level, format string, v ...interface{}) {
+	if logger.enabled(level) {
+		r := new(Record)
+		r.level = level
+		r.format = format
+		r.args = v
+		r.context = extractContext(logger.context, ctx)
+		logger.emit(r)
+	}
+}
+
+// fatal flushes and closes the handlers of logger and, while the loggers
+// propagate, of its ancestors, and then calls the exit function.
+func (logger *Logger) fatal() {
+	for l := logger; l != nil; l = l.parent {
+		for _, handler := range l.Handlers() {
+			handler.Close()
+		}
+		if !l.Propagate() {
+			break
+		}
+	}
+	logger.ExitFunc()(1)
+}
+
+// panic flushes the handlers of logger and, while the loggers propagate, of
+// its ancestors, and then panics with the message.
+func (logger *Logger) panic(message string) {
+	for l := logger; l != nil; l = l.parent {
+		for _, handler := range l.Handlers() {
+			handler.Flush()
+		}
+		if !l.Propagate() {
+			break
 		}
 	}
+	panic(message)
 }